@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -28,20 +29,25 @@ func (b *BatchExec) Add(sql string) *Exec {
 
 // Exec ...
 func (b *BatchExec) Exec(db *sql.DB) (err error) {
-	tx, err := db.Begin()
+	return b.ExecContext(context.Background(), db)
+}
+
+// ExecContext ...
+func (b *BatchExec) ExecContext(ctx context.Context, db *sql.DB) (err error) {
+	tx, err := beginTx(ctx, db, nil)
 	if err != nil {
 		return
 	}
 	defer func() {
 		if err != nil {
-			tx.Rollback()
+			rollbackTx(ctx, tx)
 		} else {
-			err = tx.Commit()
+			err = commitTx(ctx, tx)
 		}
 	}()
 
 	for _, ex := range b.execs {
-		err = ex.exec(tx)
+		err = ex.exec(ctx, tx)
 		if err != nil {
 			glog.Error(err)
 			return
@@ -0,0 +1,256 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Default values of `ClusterOption`.
+const (
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultMaxReplicationLag   = 10 * time.Second
+)
+
+// ClusterOption ...
+type ClusterOption struct {
+	// Interval of checking replicas, each check of which times out in the interval as well.
+	HealthCheckInterval time.Duration
+
+	// Replicas lagging behind the primary longer than this are excluded until they catch up.
+	MaxReplicationLag time.Duration
+}
+
+func (o ClusterOption) withDefault() ClusterOption {
+	if o.HealthCheckInterval <= 0 {
+		o.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if o.MaxReplicationLag <= 0 {
+		o.MaxReplicationLag = DefaultMaxReplicationLag
+	}
+	return o
+}
+
+// Cluster routes queries to a primary and its streaming replicas, e.g.
+//    cluster, err := NewCluster(primaryConf, replicaConfs, ClusterOption{})
+//    defer cluster.Close()
+//
+//    // writes go to the primary
+//    ids, err := BatchInsert(cluster.Primary(), "users", records)
+//
+//    // explicitly read-only queries go to a healthy replica
+//    err = cluster.Select(ctx, &users, `SELECT * FROM users WHERE age > $1`, 18)
+// Replicas are checked periodically, and those unreachable or lagging behind are excluded.
+// Reads fall back to the primary when no replica is healthy.
+type Cluster struct {
+	opt      ClusterOption
+	primary  *sql.DB
+	replicas []*replica
+
+	next uint64
+
+	stop chan struct{}
+	done chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+type replica struct {
+	db *sql.DB
+
+	mu      sync.RWMutex
+	healthy bool
+	lag     time.Duration
+}
+
+// ReplicaStatus ...
+type ReplicaStatus struct {
+	Healthy bool
+	Lag     time.Duration
+}
+
+// NewCluster opens the primary and replicas as `New` does, checks replicas once,
+// and then keeps checking them in the background until closed.
+func NewCluster(primary Conf, replicas []Conf, opt ClusterOption) (c *Cluster, err error) {
+	primaryDB, err := New(primary)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	var replicaDBs []*sql.DB
+	for _, conf := range replicas {
+		db, e := New(conf)
+		if e != nil {
+			err = e
+			glog.Error(err)
+			primaryDB.Close()
+			for _, db := range replicaDBs {
+				db.Close()
+			}
+			return
+		}
+		replicaDBs = append(replicaDBs, db)
+	}
+
+	c = newCluster(primaryDB, replicaDBs, opt)
+	return
+}
+
+func newCluster(primary *sql.DB, replicas []*sql.DB, opt ClusterOption) *Cluster {
+	c := &Cluster{
+		opt:     opt.withDefault(),
+		primary: primary,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, db := range replicas {
+		c.replicas = append(c.replicas, &replica{db: db})
+	}
+
+	c.checkReplicas()
+	go c.run()
+
+	return c
+}
+
+// Primary is for writes, e.g. by `WithTransaction` and `BatchInsert`.
+func (c *Cluster) Primary() *sql.DB {
+	return c.primary
+}
+
+// Replica chooses a healthy replica round-robin for read-only queries, or the primary if none is healthy.
+// Note that a replica may lag behind, thus reads following writes should go to the primary.
+func (c *Cluster) Replica() *sql.DB {
+	var healthy []*sql.DB
+	for _, r := range c.replicas {
+		if r.status().Healthy {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if len(healthy) == 0 {
+		return c.primary
+	}
+	return healthy[atomic.AddUint64(&c.next, 1)%uint64(len(healthy))]
+}
+
+// Select runs a read-only query on a replica as `SelectContext` does.
+func (c *Cluster) Select(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return SelectContext(ctx, c.Replica(), dest, query, args...)
+}
+
+// WithTransaction runs `queries` in a transaction on the primary as `WithTransactionContext` does.
+func (c *Cluster) WithTransaction(ctx context.Context, opts *sql.TxOptions, queries func(tx *sql.Tx) (bool, error)) error {
+	return WithTransactionContext(ctx, c.primary, opts, queries)
+}
+
+// WithReadOnlyTransaction runs `queries` in a read-only transaction on a replica, e.g. for consistent reads of many queries.
+func (c *Cluster) WithReadOnlyTransaction(ctx context.Context, queries func(tx *sql.Tx) (bool, error)) error {
+	return WithTransactionContext(ctx, c.Replica(), &sql.TxOptions{ReadOnly: true}, queries)
+}
+
+// ReplicaStatuses tells the status of each replica as of the latest check, in the order they are given.
+func (c *Cluster) ReplicaStatuses() []ReplicaStatus {
+	var statuses []ReplicaStatus
+	for _, r := range c.replicas {
+		statuses = append(statuses, r.status())
+	}
+	return statuses
+}
+
+// Close stops checking and closes all databases.
+// Closing again does nothing but returns the error of the first closing.
+func (c *Cluster) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+		<-c.done
+
+		for _, r := range c.replicas {
+			if e := r.db.Close(); e != nil {
+				glog.Error(e)
+				c.closeErr = e
+			}
+		}
+		if e := c.primary.Close(); e != nil {
+			glog.Error(e)
+			c.closeErr = e
+		}
+	})
+	return c.closeErr
+}
+
+func (c *Cluster) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opt.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.checkReplicas()
+		}
+	}
+}
+
+// checkReplicas checks replicas concurrently, so that a hanging one does not delay others.
+func (c *Cluster) checkReplicas() {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opt.HealthCheckInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, r := range c.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			r.check(ctx, c.opt.MaxReplicationLag)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// replicationLagQuery tells the replication lag in seconds, which is 0 if all received WAL is replayed,
+// since the time of the last replayed transaction grows when the primary is idle.
+const replicationLagQuery = `
+SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END::double precision`
+
+func (r *replica) check(ctx context.Context, maxLag time.Duration) {
+	var seconds float64
+	err := r.db.QueryRowContext(ctx, replicationLagQuery).Scan(&seconds)
+	lag := time.Duration(seconds * float64(time.Second))
+	healthy := err == nil && lag <= maxLag
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.healthy != healthy {
+		if err != nil {
+			glog.Warningf("replica becomes unhealthy: %v", err)
+		} else if !healthy {
+			glog.Warningf("replica becomes unhealthy, lagging %v behind", lag)
+		} else {
+			glog.Infof("replica becomes healthy")
+		}
+	}
+	r.healthy = healthy
+	r.lag = lag
+}
+
+func (r *replica) status() ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return ReplicaStatus{
+		Healthy: r.healthy,
+		Lag:     r.lag,
+	}
+}
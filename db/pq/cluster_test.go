@@ -0,0 +1,61 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCluster(t *testing.T) {
+	primary, _ := pqtest.New()
+	healthy1, fake1 := pqtest.New()
+	lagging, fake2 := pqtest.New()
+	down, fake3 := pqtest.New()
+	healthy2, fake4 := pqtest.New()
+
+	fake1.Expect(`pg_is_in_recovery`).WillReturnRows([]string{"lag"}, []driver.Value{float64(0)}).Always()
+	fake2.Expect(`pg_is_in_recovery`).WillReturnRows([]string{"lag"}, []driver.Value{float64(60)}).Always()
+	fake3.Expect(`pg_is_in_recovery`).WillReturnError(fmt.Errorf("connection refused")).Always()
+	fake4.Expect(`pg_is_in_recovery`).WillReturnRows([]string{"lag"}, []driver.Value{float64(1.5)}).Always()
+
+	c := newCluster(primary, []*sql.DB{healthy1, lagging, down, healthy2}, ClusterOption{HealthCheckInterval: time.Hour})
+	defer c.Close()
+
+	assert.Equal(t, []ReplicaStatus{
+		{Healthy: true},
+		{Healthy: false, Lag: time.Minute},
+		{Healthy: false},
+		{Healthy: true, Lag: 1500 * time.Millisecond},
+	}, c.ReplicaStatuses())
+
+	chosen := make(map[*sql.DB]int)
+	for i := 0; i < 10; i++ {
+		chosen[c.Replica()]++
+	}
+	assert.Equal(t, map[*sql.DB]int{healthy1: 5, healthy2: 5}, chosen)
+	assert.Equal(t, primary, c.Primary())
+
+	// fall back to the primary
+	fake1.Reset()
+	fake1.Expect(`pg_is_in_recovery`).WillReturnError(fmt.Errorf("connection refused")).Always()
+	fake4.Reset()
+	fake4.Expect(`pg_is_in_recovery`).WillReturnRows([]string{"lag"}, []driver.Value{float64(30)}).Always()
+	c.checkReplicas()
+	assert.Equal(t, primary, c.Replica())
+}
+
+func TestClusterCloseTwice(t *testing.T) {
+	primary, _ := pqtest.New()
+	replica, _ := pqtest.New()
+	c := newCluster(primary, []*sql.DB{replica}, ClusterOption{HealthCheckInterval: time.Hour})
+
+	assert.NoError(t, c.Close())
+	assert.NotPanics(t, func() {
+		assert.NoError(t, c.Close())
+	})
+}
@@ -0,0 +1,110 @@
+package pq
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Conventions names conventional columns of a table, which are taken care of by writes and reads of this package once registered.
+// An empty name disables the convention.
+type Conventions struct {
+	// Filled with the current time on insertion, unless provided.
+	CreatedAt ColumnName
+
+	// Filled with the current time on insertion unless provided, and on every update.
+	UpdatedAt ColumnName
+
+	// Rows with this column set are soft deleted, which are skipped by `SelectBuilder` and `Repository`,
+	// and deleting by `BatchDelete` or `Repository` sets it instead.
+	DeletedAt ColumnName
+
+	// Filled with 1 on insertion unless provided, and increased on every update.
+	// Updating a record checks its version against the row, and fails with a `*ConflictError` if the row has been modified by others since read.
+	Version ColumnName
+}
+
+// DefaultConventions ...
+var DefaultConventions = Conventions{
+	CreatedAt: "created_at",
+	UpdatedAt: "updated_at",
+	DeletedAt: "deleted_at",
+	Version:   "version",
+}
+
+var (
+	conventionsMu sync.RWMutex
+	conventions   = make(map[TableName]Conventions)
+)
+
+// RegisterConventions opts `table` in conventions, usually `DefaultConventions`, e.g. in `init`.
+func RegisterConventions(table TableName, c Conventions) {
+	conventionsMu.Lock()
+	defer conventionsMu.Unlock()
+	conventions[table] = c
+}
+
+// conventionsOf returns nil if `table` has no conventions.
+func conventionsOf(table TableName) *Conventions {
+	conventionsMu.RLock()
+	defer conventionsMu.RUnlock()
+
+	c, ok := conventions[table]
+	if !ok {
+		return nil
+	}
+	return &c
+}
+
+// fillInsert fills conventional columns missing from inserting values.
+func (c *Conventions) fillInsert(values map[string]interface{}, now time.Time) {
+	fill := func(col ColumnName, v interface{}) {
+		if col == "" {
+			return
+		}
+		if _, ok := values[string(col)]; !ok {
+			values[string(col)] = v
+		}
+	}
+	fill(c.CreatedAt, now)
+	fill(c.UpdatedAt, now)
+	fill(c.Version, 1)
+}
+
+// versioned tells if updates are checked against versions, which are then among `keys`.
+func (c *Conventions) versioned(keys []string) bool {
+	if c == nil || c.Version == "" {
+		return false
+	}
+	for _, k := range keys {
+		if k == string(c.Version) {
+			return true
+		}
+	}
+	return false
+}
+
+// makeDeleteQuery deletes rows satisfying `where`, whose placeholders are numbered from $1, or soft deletes them under conventions.
+func makeDeleteQuery(table TableName, where string, args []interface{}) (string, []interface{}) {
+	c := conventionsOf(table)
+	if c == nil || c.DeletedAt == "" {
+		return fmt.Sprintf(`DELETE FROM %s WHERE %s`, table, where), args
+	}
+
+	args = append(args, time.Now())
+	query := fmt.Sprintf(`UPDATE %s SET %s = $%d WHERE (%s) AND %s IS NULL`, table, c.DeletedAt, len(args), where, c.DeletedAt)
+	return query, args
+}
+
+// ConflictError tells records are not updated under `Conventions.Version`,
+// since their rows have been modified by others since read, or are deleted.
+type ConflictError struct {
+	Table TableName
+
+	// Number of records not updated.
+	Conflicts int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d records of %s are modified or deleted by others", e.Conflicts, e.Table)
+}
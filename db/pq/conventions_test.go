@@ -0,0 +1,91 @@
+package pq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type convPost struct {
+	ID      int    `db:"id"`
+	Title   string `db:"title"`
+	Version int    `db:"version"`
+}
+
+func init() {
+	RegisterConventions("conv_posts", DefaultConventions)
+}
+
+func TestConventionsInsert(t *testing.T) {
+	values := MapColumnWithOption(&convPost{Title: "hello"}, MapColumnOption{Table: "conv_posts"})
+	assert.Equal(t, "hello", values["title"])
+	assert.Equal(t, 1, values["version"])
+	assert.IsType(t, time.Time{}, values["created_at"])
+	assert.IsType(t, time.Time{}, values["updated_at"])
+
+	// provided values are kept
+	values = MapColumnWithOption(&convPost{Title: "hello", Version: 3}, MapColumnOption{Table: "conv_posts"})
+	assert.Equal(t, 3, values["version"])
+
+	// other tables are untouched
+	values = MapColumnWithOption(&convPost{Title: "hello"}, MapColumnOption{Table: "posts"})
+	assert.Equal(t, map[string]interface{}{"title": "hello"}, values)
+
+	columns, err := insertColumns("conv_posts", []Record{&convPost{Title: "hello"}}, InsertOption{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"title", "version", "created_at", "updated_at"}, columns)
+}
+
+func TestConventionsUpdate(t *testing.T) {
+	opt := UpdateOption{KeyColumns: []ColumnName{"id"}}
+
+	query, args, err := MakeUpdateQuery("conv_posts", &convPost{ID: 1, Title: "hello", Version: 2}, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE conv_posts SET title = $1,updated_at = $2,version = version + 1 WHERE id = $3 AND version = $4 AND deleted_at IS NULL", query)
+	assert.Len(t, args, 4)
+	assert.Equal(t, 2, args[3])
+
+	query, _, err = MakeBatchUpdateQuery("conv_posts", []Record{&convPost{ID: 1, Title: "hello", Version: 2}}, opt)
+	assert.Nil(t, err)
+	assert.Contains(t, query, "SET title = vs.title,updated_at = vs.updated_at,version = t.version + 1")
+	assert.Contains(t, query, "AS vs(id,version,title,updated_at)")
+	assert.Contains(t, query, "WHERE t.id = vs.id AND t.version = vs.version AND t.deleted_at IS NULL")
+
+	db, fake := pqtest.New()
+	fake.Expect(`^UPDATE conv_posts`).WillReturnResult(0)
+	_, err = UpdateContext(context.Background(), db, "conv_posts", &convPost{ID: 1, Title: "hello", Version: 2}, opt)
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, 1, conflict.Conflicts)
+}
+
+func TestConventionsUpsert(t *testing.T) {
+	clause, err := Upsert{ConflictColumns: []ColumnName{"id"}}.clause("conv_posts", []string{"id", "title", "version", "created_at", "updated_at"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title,updated_at = EXCLUDED.updated_at,version = conv_posts.version + 1", clause)
+
+	// the version is increased even if explicitly listed, rather than assigned twice
+	clause, err = Upsert{ConflictColumns: []ColumnName{"id"}, UpdateColumns: []ColumnName{"title", "version"}}.clause("conv_posts", []string{"id", "title", "version", "created_at", "updated_at"})
+	assert.Nil(t, err)
+	assert.Equal(t, "ON CONFLICT (id) DO UPDATE SET title = EXCLUDED.title,updated_at = EXCLUDED.updated_at,version = conv_posts.version + 1", clause)
+}
+
+func TestConventionsSoftDelete(t *testing.T) {
+	query, args := NewSelect("conv_posts", "id").Where(Eq("title", "hello")).Build()
+	assert.Equal(t, "SELECT id FROM conv_posts WHERE (title = $1) AND (conv_posts.deleted_at IS NULL)", query)
+	assert.Len(t, args, 1)
+
+	query, _ = NewSelect("conv_posts", "id").WithDeleted().Build()
+	assert.Equal(t, "SELECT id FROM conv_posts", query)
+
+	query, args = makeDeleteQuery("conv_posts", "id = $1", []interface{}{1})
+	assert.Equal(t, "UPDATE conv_posts SET deleted_at = $2 WHERE (id = $1) AND deleted_at IS NULL", query)
+	assert.Len(t, args, 2)
+
+	query, _ = makeDeleteQuery("posts", "id = $1", []interface{}{1})
+	assert.Equal(t, "DELETE FROM posts WHERE id = $1", query)
+}
@@ -0,0 +1,120 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// BulkCopy ...
+func BulkCopy(dbase *sql.DB, table TableName, records []Record) (count int64, err error) {
+	return BulkCopyWithOption(dbase, table, records, InsertOption{})
+}
+
+// BulkCopyContext ...
+func BulkCopyContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record) (count int64, err error) {
+	return BulkCopyWithOptionContext(ctx, dbase, table, records, InsertOption{})
+}
+
+// BulkCopyWithOption ...
+func BulkCopyWithOption(dbase *sql.DB, table TableName, records []Record, opt InsertOption) (count int64, err error) {
+	return BulkCopyWithOptionContext(context.Background(), dbase, table, records, opt)
+}
+
+// BulkCopyWithOptionContext ...
+func BulkCopyWithOptionContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt InsertOption) (count int64, err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		count, err = BulkCopyTransactionContext(ctx, tx, table, records, opt)
+		if opt.Abort != nil {
+			abort = *opt.Abort
+		}
+		return
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// BulkCopyTransaction streams records into the table by `COPY ... FROM STDIN`, which is much faster than `BatchInsertTransaction` for large amount of records,
+// and returns the number of rows loaded.
+// Records are still split into batches as `BatchInsertTransaction` does, for the callbacks and the abort flag in `opt` to take effect between batches.
+// Since `COPY` neither resolves conflicts nor returns ids, `opt.OnConflict`, `opt.Upsert` and `opt.ForeignKeys` are not supported.
+func BulkCopyTransaction(tx *sql.Tx, table TableName, records []Record, opt InsertOption) (count int64, err error) {
+	return BulkCopyTransactionContext(context.Background(), tx, table, records, opt)
+}
+
+// BulkCopyTransactionContext ...
+func BulkCopyTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt InsertOption) (count int64, err error) {
+	if opt.OnConflict != "" || opt.Upsert != nil || len(opt.ForeignKeys) > 0 {
+		err = fmt.Errorf("OnConflict, Upsert and ForeignKeys are not supported in copying")
+		glog.Error(err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	columns, err := insertColumns(table, records, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	// quoted as a whole, a qualified name would not be found
+	query := pq.CopyIn(string(table), columns...)
+	if schema, name := table.split(); schema != "" {
+		query = pq.CopyInSchema(schema, name, columns...)
+	}
+
+	// observed as a whole, whose rows are not arguments
+	start := time.Now()
+	defer func() {
+		observe(ctx, QueryKindExec, query, 0, start, count, err)
+	}()
+
+	stt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	defer stt.Close()
+
+	err = forEachBatch(ctx, records, columns, opt, func(recs []Record) error {
+		for _, rec := range recs {
+			cols := mapColumn(table, rec, opt)
+
+			args := make([]interface{}, len(columns))
+			for i, col := range columns {
+				args[i] = cols[col]
+			}
+			if _, e := stt.ExecContext(ctx, args...); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	// flush buffered rows and finish copying
+	res, err := stt.ExecContext(ctx)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	count, err = res.RowsAffected()
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	return
+}
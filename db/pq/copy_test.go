@@ -0,0 +1,65 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkCopy(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^COPY`).WillReturnResult(2).Always()
+
+	count, err := BulkCopy(db, "public.users", []Record{
+		insertRecord{Name: "Tom", Email: "tom@example.com", Age: 3},
+		insertRecord{Email: "jerry@example.com"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// values follow the columns, and are flushed by an exec without arguments
+	var execs []pqtest.Event
+	for _, e := range fake.Events() {
+		if e.Kind == pqtest.EventExec {
+			execs = append(execs, e)
+		}
+	}
+	assert.Len(t, execs, 3)
+	assert.Equal(t, `COPY "public"."users" ("name", "age", "email") FROM STDIN`, execs[0].SQL)
+	assert.Equal(t, []driver.Value{"Tom", int64(3), "tom@example.com"}, execs[0].Args)
+	assert.Equal(t, []driver.Value{nil, nil, "jerry@example.com"}, execs[1].Args)
+	assert.Empty(t, execs[2].Args)
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+
+	// nothing to copy
+	fake.Reset()
+	count, err = BulkCopy(db, "users", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, 0, fake.Count(pqtest.EventExec))
+}
+
+func TestBulkCopyCanceled(t *testing.T) {
+	db, fake := pqtest.New()
+
+	// one column makes batches of `PlaceholderLimit` records
+	records := make([]Record, PlaceholderLimit+1)
+	for i := range records {
+		records[i] = struct {
+			Name string `db:"name"`
+		}{"Tom"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := BulkCopyWithOptionContext(ctx, db, "users", records, InsertOption{
+		BatchCallback: func(int) { cancel() },
+	})
+	assert.Equal(t, context.Canceled, err)
+
+	// the first batch is copied but not flushed
+	assert.Equal(t, PlaceholderLimit, fake.Count(pqtest.EventExec))
+	assert.Equal(t, 0, fake.Count(pqtest.EventCommit))
+}
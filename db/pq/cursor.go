@@ -0,0 +1,208 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultFetchSize is the number of rows fetched at a time by a cursor.
+const DefaultFetchSize = 1000
+
+var cursorCount uint64
+
+// Cursor iterates over rows of a query by a server-side cursor, holding at most one chunk of rows in memory, e.g.
+//    err := WithCursor(ctx, db, `SELECT * FROM orders WHERE year = $1`, []interface{}{2020}, 0, func(c *Cursor) error {
+//        for c.Next() {
+//            var o Order
+//            if err := c.Scan(&o); err != nil {
+//                return err
+//            }
+//            ...
+//        }
+//        return c.Err()
+//    })
+type Cursor struct {
+	ctx       context.Context
+	tx        *sql.Tx
+	name      string
+	fetchSize int
+
+	rows      *sql.Rows
+	columns   []string
+	fetched   int
+	exhausted bool
+	closed    bool
+	err       error
+
+	scanner     *structScanner
+	scannerType reflect.Type
+}
+
+// OpenCursor declares a cursor of `query` in `tx`, fetching `fetchSize` rows at a time, or `DefaultFetchSize` if not positive.
+// The cursor lives until closed or the transaction ends, and stops iterating once `ctx` is done.
+func OpenCursor(ctx context.Context, tx *sql.Tx, query string, args []interface{}, fetchSize int) (c *Cursor, err error) {
+	if fetchSize <= 0 {
+		fetchSize = DefaultFetchSize
+	}
+
+	name := fmt.Sprintf("pq_cursor_%d", atomic.AddUint64(&cursorCount, 1))
+	start := time.Now()
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`DECLARE %s NO SCROLL CURSOR FOR %s`, name, query), args...)
+	observe(ctx, QueryKindExec, query, len(args), start, -1, err)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	c = &Cursor{
+		ctx:       ctx,
+		tx:        tx,
+		name:      name,
+		fetchSize: fetchSize,
+	}
+	return
+}
+
+// WithCursor runs `fn` with a cursor of `query` in a read-only transaction.
+func WithCursor(ctx context.Context, db *sql.DB, query string, args []interface{}, fetchSize int, fn func(c *Cursor) error) (err error) {
+	return WithTransactionContext(ctx, db, &sql.TxOptions{ReadOnly: true}, func(tx *sql.Tx) (bool, error) {
+		c, err := OpenCursor(ctx, tx, query, args, fetchSize)
+		if err != nil {
+			return false, err
+		}
+		defer c.Close()
+
+		return false, fn(c)
+	})
+}
+
+// Next advances to the next row, fetching the next chunk when the current one is used up,
+// and returns false when rows are exhausted, or an error occurs which is reported by `Err`.
+func (c *Cursor) Next() bool {
+	if c.closed || c.err != nil {
+		return false
+	}
+
+	for {
+		if c.rows != nil {
+			if c.rows.Next() {
+				c.fetched++
+				return true
+			}
+			if c.err = c.rows.Err(); c.err != nil {
+				return false
+			}
+			c.rows.Close()
+			c.rows = nil
+
+			// a partial chunk is the last one
+			if c.fetched < c.fetchSize {
+				c.exhausted = true
+			}
+		}
+		if c.exhausted {
+			return false
+		}
+
+		if c.err = c.ctx.Err(); c.err != nil {
+			return false
+		}
+		query := fmt.Sprintf(`FETCH %d FROM %s`, c.fetchSize, c.name)
+		start := time.Now()
+		c.rows, c.err = c.tx.QueryContext(c.ctx, query)
+		// rows are not counted until iterated by the caller
+		observe(c.ctx, QueryKindQuery, query, 0, start, -1, c.err)
+		if c.err != nil {
+			return false
+		}
+		if c.columns == nil {
+			if c.columns, c.err = c.rows.Columns(); c.err != nil {
+				return false
+			}
+		}
+		c.fetched = 0
+	}
+}
+
+// Columns is available after the first call of `Next`, even if there is no row, unless it fails.
+func (c *Cursor) Columns() []string {
+	return c.columns
+}
+
+// Scan scans the current row into `dest`, which can be a pointer to
+//    - a struct, by matching column names to `db` tags as `Select` does.
+//    - a `map[string]interface{}`, which is replaced by one of the row.
+//    - a value of other types, into which the only column is scanned.
+func (c *Cursor) Scan(dest interface{}) (err error) {
+	if c.rows == nil {
+		err = fmt.Errorf("scanning without calling Next")
+		return
+	}
+
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		err = fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+		return
+	}
+	val = val.Elem()
+
+	switch {
+	case val.Type() == mapType:
+		m, e := scanMap(c.rows, c.columns)
+		if e != nil {
+			err = e
+			return
+		}
+		val.Set(reflect.ValueOf(m))
+	case isStructType(val.Type()):
+		// columns are the same for all chunks, thus the scanner is reused
+		if c.scannerType != val.Type() {
+			if c.scanner, err = newStructScanner(c.rows, val.Type()); err != nil {
+				return
+			}
+			c.scannerType = val.Type()
+		}
+		err = c.scanner.scan(c.rows, val)
+	default:
+		if len(c.columns) != 1 {
+			err = fmt.Errorf("expect exactly 1 column to scan into %T, got %d", dest, len(c.columns))
+			return
+		}
+		err = c.rows.Scan(scanDest(val))
+	}
+	return
+}
+
+// Err ...
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close closes the cursor, which is unnecessary if the transaction ends soon.
+func (c *Cursor) Close() (err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+
+	if c.rows != nil {
+		c.rows.Close()
+		c.rows = nil
+	}
+
+	// the transaction is rolled back anyway if `ctx` is done
+	if c.ctx.Err() != nil {
+		return
+	}
+	if _, err = execObserved(c.ctx, c.tx, `CLOSE `+c.name, nil); err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
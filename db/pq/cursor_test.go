@@ -0,0 +1,123 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	db, fake := pqtest.New()
+	columns := []string{"id", "name"}
+	fake.Expect(`^FETCH 2 FROM pq_cursor_\d+$`).WillReturnRows(columns, []driver.Value{int64(1), "Tom"}, []driver.Value{int64(2), "Amy"})
+	fake.Expect(`^FETCH 2 FROM pq_cursor_\d+$`).WillReturnRows(columns, []driver.Value{int64(3), "Bob"})
+
+	type user struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	var users []user
+	err := WithCursor(context.Background(), db, `SELECT id, name FROM users WHERE age > $1`, []interface{}{18}, 2, func(c *Cursor) error {
+		for c.Next() {
+			var u user
+			if err := c.Scan(&u); err != nil {
+				return err
+			}
+			users = append(users, u)
+		}
+		return c.Err()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []user{{1, "Tom"}, {2, "Amy"}, {3, "Bob"}}, users)
+
+	stmts := fake.Statements()
+	assert.Len(t, stmts, 4)
+	assert.Regexp(t, `^DECLARE pq_cursor_\d+ NO SCROLL CURSOR FOR SELECT id, name FROM users WHERE age > \$1$`, stmts[0])
+	assert.Regexp(t, `^CLOSE pq_cursor_\d+$`, stmts[3])
+	assert.True(t, fake.Events()[0].TxOptions.ReadOnly)
+	assert.NoError(t, fake.ExpectationsWereMet())
+}
+
+func TestCursorCanceled(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^FETCH`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}).Always()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	err := WithCursor(ctx, db, `SELECT id FROM users`, nil, 2, func(c *Cursor) error {
+		for c.Next() {
+			count++
+			if count == 3 {
+				cancel()
+			}
+		}
+		return c.Err()
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 4, count)
+}
+
+func TestWriteCSVAndJSONL(t *testing.T) {
+	db, fake := pqtest.New()
+	columns := []string{"id", "name", "note"}
+	rows := [][]driver.Value{{int64(1), "Tom", nil}, {int64(2), "Amy, Jr.", []byte("hi")}}
+	fake.Expect(`^FETCH`).WillReturnRows(columns, rows...).Always()
+
+	var csvOut, jsonlOut strings.Builder
+	err := WithCursor(context.Background(), db, `SELECT * FROM users`, nil, 0, func(c *Cursor) error {
+		n, err := WriteCSV(&csvOut, c)
+		assert.Equal(t, int64(2), n)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "id,name,note\n1,Tom,\n2,\"Amy, Jr.\",hi\n", csvOut.String())
+
+	err = WithCursor(context.Background(), db, `SELECT * FROM users`, nil, 0, func(c *Cursor) error {
+		n, err := WriteJSONL(&jsonlOut, c)
+		assert.Equal(t, int64(2), n)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"id\":1,\"name\":\"Tom\",\"note\":null}\n{\"id\":2,\"name\":\"Amy, Jr.\",\"note\":\"hi\"}\n", jsonlOut.String())
+}
+
+func TestWriteCSVEmpty(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^FETCH`).WillReturnRows([]string{"id", "name"})
+
+	var out strings.Builder
+	err := WithCursor(context.Background(), db, `SELECT id, name FROM users WHERE false`, nil, 0, func(c *Cursor) error {
+		n, err := WriteCSV(&out, c)
+		assert.Equal(t, int64(0), n)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "id,name\n", out.String())
+}
+
+func TestCursorHook(t *testing.T) {
+	var events []QueryEvent
+	AddHook(HookFunc(func(ctx context.Context, event QueryEvent) {
+		events = append(events, event)
+	}))
+	defer RemoveHooks()
+
+	db, fake := pqtest.New()
+	fake.Expect(`^FETCH`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)})
+	err := WithCursor(context.Background(), db, `SELECT id FROM users`, nil, 2, func(c *Cursor) error {
+		for c.Next() {
+		}
+		return c.Err()
+	})
+	assert.NoError(t, err)
+
+	var got []string
+	for _, e := range events {
+		got = append(got, string(e.Kind)+" "+strings.Split(e.SQL, " ")[0])
+	}
+	assert.Equal(t, []string{"begin BEGIN", "exec SELECT", "query FETCH", "exec CLOSE", "commit COMMIT"}, got)
+}
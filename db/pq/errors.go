@@ -0,0 +1,155 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/lib/pq"
+)
+
+// ErrorClass ...
+type ErrorClass int
+
+// Classes of errors which callers usually handle differently.
+const (
+	ErrorClassUnknown ErrorClass = iota
+	ErrorClassUniqueViolation
+	ErrorClassForeignKeyViolation
+	ErrorClassNotNullViolation
+	ErrorClassCheckViolation
+
+	// Serialization failures and deadlocks, which go away by retrying the transaction.
+	ErrorClassSerialization
+
+	// Errors of the connection rather than the statement.
+	ErrorClassConnection
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassUniqueViolation:
+		return "unique_violation"
+	case ErrorClassForeignKeyViolation:
+		return "foreign_key_violation"
+	case ErrorClassNotNullViolation:
+		return "not_null_violation"
+	case ErrorClassCheckViolation:
+		return "check_violation"
+	case ErrorClassSerialization:
+		return "serialization"
+	case ErrorClassConnection:
+		return "connection"
+	}
+	return "unknown"
+}
+
+// SQLSTATE codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	codeUniqueViolation      pq.ErrorCode = "23505"
+	codeForeignKeyViolation  pq.ErrorCode = "23503"
+	codeNotNullViolation     pq.ErrorCode = "23502"
+	codeCheckViolation       pq.ErrorCode = "23514"
+	codeSerializationFailure pq.ErrorCode = "40001"
+	codeDeadlockDetected     pq.ErrorCode = "40P01"
+	codeAdminShutdown        pq.ErrorCode = "57P01"
+	codeCrashShutdown        pq.ErrorCode = "57P02"
+	codeCannotConnectNow     pq.ErrorCode = "57P03"
+
+	classConnectionException = "08"
+)
+
+// ErrorInfo tells what an error is about, for callers to respond precisely.
+type ErrorInfo struct {
+	Class ErrorClass
+
+	// The following are empty unless the error is reported by PostgreSQL.
+	Code       pq.ErrorCode
+	Constraint string
+	Table      string
+	Column     string
+	Detail     string
+}
+
+// ClassifyError inspects an error, which can be wrapped, e.g.
+//    info := ClassifyError(err)
+//    if info.Class == ErrorClassUniqueViolation && info.Constraint == "users_email_key" {
+//        // respond with 409
+//    }
+func ClassifyError(err error) (info ErrorInfo) {
+	if err == nil {
+		return
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		info.Code = pqErr.Code
+		info.Constraint = pqErr.Constraint
+		info.Table = pqErr.Table
+		info.Column = pqErr.Column
+		info.Detail = pqErr.Detail
+
+		switch pqErr.Code {
+		case codeUniqueViolation:
+			info.Class = ErrorClassUniqueViolation
+		case codeForeignKeyViolation:
+			info.Class = ErrorClassForeignKeyViolation
+		case codeNotNullViolation:
+			info.Class = ErrorClassNotNullViolation
+		case codeCheckViolation:
+			info.Class = ErrorClassCheckViolation
+		case codeSerializationFailure, codeDeadlockDetected:
+			info.Class = ErrorClassSerialization
+		case codeAdminShutdown, codeCrashShutdown, codeCannotConnectNow:
+			info.Class = ErrorClassConnection
+		default:
+			if pqErr.Code.Class() == classConnectionException {
+				info.Class = ErrorClassConnection
+			}
+		}
+		return
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr) {
+		info.Class = ErrorClassConnection
+	}
+
+	return
+}
+
+// IsUniqueViolation ...
+func IsUniqueViolation(err error) bool {
+	return ClassifyError(err).Class == ErrorClassUniqueViolation
+}
+
+// IsForeignKeyViolation ...
+func IsForeignKeyViolation(err error) bool {
+	return ClassifyError(err).Class == ErrorClassForeignKeyViolation
+}
+
+// IsNotNullViolation ...
+func IsNotNullViolation(err error) bool {
+	return ClassifyError(err).Class == ErrorClassNotNullViolation
+}
+
+// IsCheckViolation ...
+func IsCheckViolation(err error) bool {
+	return ClassifyError(err).Class == ErrorClassCheckViolation
+}
+
+// IsSerializationError tells if an error is a serialization failure or a deadlock.
+func IsSerializationError(err error) bool {
+	return ClassifyError(err).Class == ErrorClassSerialization
+}
+
+// IsConnectionError ...
+func IsConnectionError(err error) bool {
+	return ClassifyError(err).Class == ErrorClassConnection
+}
+
+// IsDuplicatedKeyError tells if an error violates the unique constraint named `keyName`.
+func IsDuplicatedKeyError(err error, keyName string) bool {
+	info := ClassifyError(err)
+	return info.Class == ErrorClassUniqueViolation && info.Constraint == keyName
+}
@@ -0,0 +1,30 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	err := fmt.Errorf("inserting user: %w", &pq.Error{Code: "23505", Constraint: "users_email_key", Table: "users"})
+	info := ClassifyError(err)
+	assert.Equal(t, ErrorClassUniqueViolation, info.Class)
+	assert.Equal(t, "users_email_key", info.Constraint)
+	assert.Equal(t, "users", info.Table)
+	assert.True(t, IsDuplicatedKeyError(err, "users_email_key"))
+	assert.False(t, IsDuplicatedKeyError(err, "users_name_key"))
+
+	assert.True(t, IsForeignKeyViolation(&pq.Error{Code: "23503"}))
+	assert.True(t, IsNotNullViolation(&pq.Error{Code: "23502", Column: "name"}))
+	assert.True(t, IsCheckViolation(&pq.Error{Code: "23514"}))
+	assert.True(t, IsSerializationError(&pq.Error{Code: "40P01"}))
+	assert.True(t, IsConnectionError(&pq.Error{Code: "08006"}))
+	assert.True(t, IsConnectionError(fmt.Errorf("query: %w", driver.ErrBadConn)))
+
+	assert.Equal(t, ErrorClassUnknown, ClassifyError(nil).Class)
+	assert.Equal(t, ErrorClassUnknown, ClassifyError(fmt.Errorf(`pq: duplicate key value violates unique constraint "users_email_key"`)).Class)
+}
@@ -1,7 +1,9 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
+	"time"
 )
 
 // Exec ...
@@ -10,6 +12,9 @@ type Exec struct {
 	multiRows bool
 	args      []interface{}
 	dest      []interface{}
+	rowsDest  interface{}
+	rowFunc   func(rows *sql.Rows) error
+	rowCount  int64
 }
 
 // SetArgs ...
@@ -30,33 +35,95 @@ func (ex *Exec) AddScan(dest interface{}) *Exec {
 	return ex
 }
 
-// SetMultiRows ...
+// SetMultiRows scans the first column of the i-th row into the i-th scan, and rows beyond scans are discarded.
+//
+// Deprecated: other columns are silently dropped, use `SetRows` or `SetRowFunc` to scan every column of every row instead.
 func (ex *Exec) SetMultiRows() *Exec {
 	ex.multiRows = true
 	return ex
 }
 
-func (ex *Exec) exec(tx *sql.Tx) (err error) {
-	stt, e := tx.Prepare(ex.sql)
+// SetRows appends every row to `dest` as `ScanRows` does, which must be a pointer to a slice.
+func (ex *Exec) SetRows(dest interface{}) *Exec {
+	ex.rowsDest = dest
+	return ex
+}
+
+// SetRowFunc calls `fn` on every row, which should scan the row by itself.
+func (ex *Exec) SetRowFunc(fn func(rows *sql.Rows) error) *Exec {
+	ex.rowFunc = fn
+	return ex
+}
+
+// RowCount tells the number of rows returned by a query, or affected by a statement without scans, after executed.
+func (ex *Exec) RowCount() int64 {
+	return ex.rowCount
+}
+
+func (ex *Exec) exec(ctx context.Context, tx *sql.Tx) (err error) {
+	kind := QueryKindQuery
+	if ex.rowsDest == nil && ex.rowFunc == nil && len(ex.dest) == 0 {
+		kind = QueryKindExec
+	}
+
+	start := time.Now()
+	ex.rowCount = 0
+	err = ex.run(ctx, tx)
+	observe(ctx, kind, ex.sql, len(ex.args), start, ex.rowCount, err)
+	return
+}
+
+func (ex *Exec) run(ctx context.Context, tx *sql.Tx) (err error) {
+	stt, e := tx.PrepareContext(ctx, ex.sql)
 	if e != nil {
 		err = e
 		return
 	}
 	defer stt.Close()
 
-	if len(ex.dest) == 0 {
-		if _, e := stt.Exec(ex.args...); e != nil {
+	if ex.rowsDest != nil || ex.rowFunc != nil {
+		rows, e := stt.QueryContext(ctx, ex.args...)
+		if e != nil {
 			err = e
 			return
 		}
+		defer rows.Close()
+
+		counter := &countingRows{Rows: rows}
+		if ex.rowsDest != nil {
+			err = scanRows(counter, ex.rowsDest)
+		} else {
+			for counter.Next() {
+				if err = ex.rowFunc(rows); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = rows.Err()
+			}
+		}
+		ex.rowCount = counter.count
+		if err != nil {
+			return
+		}
+	} else if len(ex.dest) == 0 {
+		res, e := stt.ExecContext(ctx, ex.args...)
+		if e != nil {
+			err = e
+			return
+		}
+		if n, e := res.RowsAffected(); e == nil {
+			ex.rowCount = n
+		}
 	} else if !ex.multiRows {
-		row := stt.QueryRow(ex.args...)
+		row := stt.QueryRowContext(ctx, ex.args...)
 		if e := row.Scan(ex.dest...); e != nil {
 			err = e
 			return
 		}
+		ex.rowCount = 1
 	} else {
-		rows, e := stt.Query(ex.args...)
+		rows, e := stt.QueryContext(ctx, ex.args...)
 		if e != nil {
 			err = e
 			return
@@ -70,7 +137,25 @@ func (ex *Exec) exec(tx *sql.Tx) (err error) {
 			}
 			i++
 		}
+		if err = rows.Err(); err != nil {
+			return
+		}
+		ex.rowCount = int64(i)
 	}
 
 	return
 }
+
+// countingRows counts the rows iterated.
+type countingRows struct {
+	*sql.Rows
+	count int64
+}
+
+func (r *countingRows) Next() bool {
+	if !r.Rows.Next() {
+		return false
+	}
+	r.count++
+	return true
+}
@@ -0,0 +1,74 @@
+package pq
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRows(t *testing.T) {
+	db, fake := pqtest.New()
+	columns := []string{"id", "name"}
+	fake.Expect(`^SELECT id, name FROM users$`).WillReturnRows(columns, []driver.Value{int64(1), "Tom"}, []driver.Value{int64(2), "Amy"})
+	fake.Expect(`^SELECT id, name FROM pets$`).WillReturnRows(columns, []driver.Value{int64(3), "Spike"}, []driver.Value{int64(4), "Tyke"})
+	fake.Expect(`^UPDATE users`).WillReturnResult(2)
+	fake.Expect(`^SELECT id FROM users$`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)}, []driver.Value{int64(3)})
+
+	type user struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	var users []user
+	var pets []string
+	var first, second int
+
+	b := NewBatchExec()
+	rowsExec := b.Add(`SELECT id, name FROM users`).SetRows(&users)
+	funcExec := b.Add(`SELECT id, name FROM pets`).SetRowFunc(func(rows *sql.Rows) error {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		pets = append(pets, name)
+		return nil
+	})
+	updateExec := b.Add(`UPDATE users SET age = age + 1`)
+	multiExec := b.Add(`SELECT id FROM users`).SetScans(&first, &second).SetMultiRows()
+	assert.NoError(t, b.Exec(db))
+
+	// rows are sequenced as returned
+	assert.Equal(t, []user{{1, "Tom"}, {2, "Amy"}}, users)
+	assert.Equal(t, []string{"Spike", "Tyke"}, pets)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 2, second)
+
+	assert.Equal(t, int64(2), rowsExec.RowCount())
+	assert.Equal(t, int64(2), funcExec.RowCount())
+	assert.Equal(t, int64(2), updateExec.RowCount())
+	// rows beyond scans are discarded
+	assert.Equal(t, int64(2), multiExec.RowCount())
+
+	assert.NoError(t, fake.ExpectationsWereMet())
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+}
+
+func TestExecRowFuncError(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^SELECT id FROM users$`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+
+	b := NewBatchExec()
+	ex := b.Add(`SELECT id FROM users`).SetRowFunc(func(rows *sql.Rows) error {
+		return sql.ErrNoRows
+	})
+	b.Add(`UPDATE users SET age = age + 1`)
+	assert.Equal(t, sql.ErrNoRows, b.Exec(db))
+
+	// rows stop at the error, and following statements are not run
+	assert.Equal(t, int64(1), ex.RowCount())
+	assert.Equal(t, []string{`SELECT id FROM users`}, fake.Statements())
+	assert.Equal(t, 1, fake.Count(pqtest.EventRollback))
+}
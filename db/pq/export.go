@@ -0,0 +1,98 @@
+package pq
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WriteCSV writes the remaining rows of a cursor as CSV with a header of column names, even if there is no row,
+// and returns the number of rows written.
+// NULL is written as an empty field, and time as RFC 3339.
+func WriteCSV(w io.Writer, c *Cursor) (count int64, err error) {
+	cw := csv.NewWriter(w)
+
+	var record []string
+	for c.Next() {
+		var m map[string]interface{}
+		if err = c.Scan(&m); err != nil {
+			return
+		}
+
+		columns := c.Columns()
+		if record == nil {
+			if err = cw.Write(columns); err != nil {
+				return
+			}
+			record = make([]string, len(columns))
+		}
+		for i, col := range columns {
+			record[i] = formatField(m[col])
+		}
+		if err = cw.Write(record); err != nil {
+			return
+		}
+		count++
+	}
+	if err = c.Err(); err != nil {
+		return
+	}
+	if record == nil && c.Columns() != nil {
+		// the header of an empty result
+		if err = cw.Write(c.Columns()); err != nil {
+			return
+		}
+	}
+
+	cw.Flush()
+	err = cw.Error()
+	return
+}
+
+// WriteJSONL writes the remaining rows of a cursor as JSON objects keyed by column names, one per line,
+// and returns the number of rows written.
+func WriteJSONL(w io.Writer, c *Cursor) (count int64, err error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	for c.Next() {
+		var m map[string]interface{}
+		if err = c.Scan(&m); err != nil {
+			return
+		}
+		for col, v := range m {
+			// text-like values such as numeric come as bytes, which should not be base64 encoded
+			if b, ok := v.([]byte); ok {
+				m[col] = string(b)
+			}
+		}
+		// the encoder terminates each value by a newline
+		if err = enc.Encode(m); err != nil {
+			return
+		}
+		count++
+	}
+	if err = c.Err(); err != nil {
+		return
+	}
+
+	err = bw.Flush()
+	return
+}
+
+func formatField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
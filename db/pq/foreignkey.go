@@ -0,0 +1,235 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// InsertResult ...
+type InsertResult struct {
+	ID       int
+	Inserted bool
+
+	// Foreign key columns referencing missing rows, due to which the record is rejected.
+	MissingForeignKeys []ColumnName
+}
+
+// ForeignKeyError reports records referencing missing rows, under `InsertOption.FailOnMissingForeignKey`.
+type ForeignKeyError struct {
+	// Index of each rejected record in the input, and its foreign key columns referencing missing rows.
+	Rejected map[int][]ColumnName
+}
+
+func (e *ForeignKeyError) Error() string {
+	var indices []int
+	for i := range e.Rejected {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+
+	var parts []string
+	for _, i := range indices {
+		parts = append(parts, fmt.Sprintf("record %d (%s)", i, joinColumnNames(e.Rejected[i])))
+	}
+	return "missing foreign keys: " + strings.Join(parts, ", ")
+}
+
+// BatchInsertReport ...
+func BatchInsertReport(dbase *sql.DB, table TableName, records []Record, opt InsertOption) (results []InsertResult, err error) {
+	return BatchInsertReportContext(context.Background(), dbase, table, records, opt)
+}
+
+// BatchInsertReportContext ...
+func BatchInsertReportContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt InsertOption) (results []InsertResult, err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		results, err = BatchInsertReportTransactionContext(ctx, tx, table, records, opt)
+		if opt.Abort != nil {
+			abort = *opt.Abort
+		}
+		return
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// BatchInsertReportTransaction ...
+func BatchInsertReportTransaction(tx *sql.Tx, table TableName, records []Record, opt InsertOption) (results []InsertResult, err error) {
+	return BatchInsertReportTransactionContext(context.Background(), tx, table, records, opt)
+}
+
+// BatchInsertReportTransactionContext inserts records as `BatchInsertTransaction` does, but checks `opt.ForeignKeys` before inserting,
+// and returns one result for each record in the same order, telling whether it is inserted, or rejected due to which foreign keys.
+// A NULL foreign key is considered missing, as `MakeBatchInsertQuery` does.
+// Under `opt.FailOnMissingForeignKey`, a `*ForeignKeyError` is returned instead if any record is rejected.
+// `opt.OnConflict` and `opt.Upsert` are not supported, since conflicting records are not returned.
+func BatchInsertReportTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt InsertOption) (results []InsertResult, err error) {
+	if opt.OnConflict != "" || opt.Upsert != nil {
+		err = fmt.Errorf("OnConflict and Upsert are not supported in reporting")
+		glog.Error(err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	columns, err := insertColumns(table, records, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	stmts := newStmtCache(tx)
+	defer stmts.close()
+
+	// foreign keys are checked by ourselves, thus records are inserted plainly
+	insertOpt := opt
+	insertOpt.ForeignKeys = nil
+
+	results = make([]InsertResult, len(records))
+	var offset int
+	err = forEachBatch(ctx, records, columns, opt, func(recs []Record) error {
+		missing, e := checkForeignKeys(ctx, stmts, recs, opt)
+		if e != nil {
+			return e
+		}
+
+		if opt.FailOnMissingForeignKey && len(missing) > 0 {
+			rejected := make(map[int][]ColumnName)
+			for i, cols := range missing {
+				rejected[offset+i] = cols
+			}
+			return &ForeignKeyError{Rejected: rejected}
+		}
+
+		var valid []Record
+		var indices []int
+		for i, rec := range recs {
+			if cols, ok := missing[i]; ok {
+				results[offset+i].MissingForeignKeys = cols
+				continue
+			}
+			valid = append(valid, rec)
+			indices = append(indices, offset+i)
+		}
+
+		if len(valid) > 0 {
+			ids, e := insertBatch(ctx, stmts, table, valid, columns, insertOpt)
+			if e != nil {
+				return e
+			}
+			if !opt.NoID && len(ids) != len(valid) {
+				return fmt.Errorf("%d ids are returned for %d records", len(ids), len(valid))
+			}
+			for j, i := range indices {
+				results[i].Inserted = true
+				if !opt.NoID {
+					results[i].ID = ids[j]
+				}
+			}
+		}
+
+		offset += len(recs)
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	// in case of aborting
+	results = results[:offset]
+
+	return
+}
+
+// checkForeignKeys tells the foreign key columns referencing missing rows, by the index of records.
+func checkForeignKeys(ctx context.Context, stmts *stmtCache, records []Record, opt InsertOption) (missing map[int][]ColumnName, err error) {
+	missing = make(map[int][]ColumnName)
+	if len(opt.ForeignKeys) == 0 {
+		return
+	}
+
+	var values []map[string]interface{}
+	for _, rec := range records {
+		values = append(values, mapColumnKeeping(rec, opt.KeepEmptyValueColums))
+	}
+
+	// iterate in a fixed order for the result to be stable
+	var fkFields []string
+	for field := range opt.ForeignKeys {
+		fkFields = append(fkFields, string(field))
+	}
+	sort.Strings(fkFields)
+
+	for _, field := range fkFields {
+		ref := opt.ForeignKeys[ColumnName(field)]
+
+		// NULL references nothing
+		var ords []int
+		for i, vs := range values {
+			if vs[field] == nil {
+				missing[i] = append(missing[i], ColumnName(field))
+				continue
+			}
+			ords = append(ords, i)
+		}
+		if len(ords) == 0 {
+			continue
+		}
+
+		var args []interface{}
+		rows := []string{fmt.Sprintf("(NULL::integer,%s)", typedNull(ref.Table, string(ref.Name)))}
+		for _, i := range ords {
+			args = append(args, values[i][field])
+			rows = append(rows, fmt.Sprintf("(%d,$%d)", i, len(args)))
+		}
+
+		query := fmt.Sprintf(`
+		SELECT vs.fk_ord FROM (
+			VALUES %s
+		) AS vs(fk_ord, fk_value)
+		WHERE vs.fk_ord IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM %s AS ref WHERE ref.%s = vs.fk_value
+		)`,
+			strings.Join(rows, ","),
+			ref.Table,
+			ref.Name,
+		)
+
+		stt, e := stmts.prepare(ctx, query)
+		if e != nil {
+			err = e
+			return
+		}
+		if err = collectMissing(ctx, stt, args, ColumnName(field), missing); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func collectMissing(ctx context.Context, stt *sql.Stmt, args []interface{}, field ColumnName, missing map[int][]ColumnName) (err error) {
+	rows, err := stt.QueryContext(ctx, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ord int
+		if err = rows.Scan(&ord); err != nil {
+			return
+		}
+		missing[ord] = append(missing[ord], field)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,75 @@
+package pq
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForeignKeyError(t *testing.T) {
+	err := &ForeignKeyError{Rejected: map[int][]ColumnName{
+		7: {"owner_id"},
+		2: {"group_id", "owner_id"},
+	}}
+	assert.Equal(t, "missing foreign keys: record 2 (group_id,owner_id), record 7 (owner_id)", err.Error())
+}
+
+func TestBatchInsertReport(t *testing.T) {
+	opt := InsertOption{
+		ForeignKeys: map[ColumnName]Column{
+			"owner_id": {Table: "users", Name: "id"},
+			"group_id": {Table: "groups", Name: "id"},
+		},
+	}
+	records := []Record{
+		insertRecord{Name: "Tom", OwnerID: 1, GroupID: 2},
+		insertRecord{Name: "Jerry", OwnerID: 9, GroupID: 2},
+		// a NULL foreign key is missing
+		insertRecord{Name: "Spike", GroupID: 3},
+	}
+	expect := func(fake *pqtest.Fake) {
+		fake.Expect(`FROM groups AS ref`).WillReturnRows([]string{"fk_ord"}, []driver.Value{int64(2)})
+		fake.Expect(`FROM users AS ref`).WillReturnRows([]string{"fk_ord"}, []driver.Value{int64(1)})
+		fake.Expect(`^INSERT INTO pets`).WillReturnRows([]string{"id"}, []driver.Value{int64(10)})
+	}
+
+	db, fake := pqtest.New()
+	expect(fake)
+	results, err := BatchInsertReport(db, "pets", records, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, []InsertResult{
+		{ID: 10, Inserted: true},
+		{MissingForeignKeys: []ColumnName{"owner_id"}},
+		{MissingForeignKeys: []ColumnName{"group_id", "owner_id"}},
+	}, results)
+	assert.NoError(t, fake.ExpectationsWereMet())
+
+	// only present references are checked, and only valid records are inserted
+	var queries []pqtest.Event
+	for _, e := range fake.Events() {
+		if e.Kind == pqtest.EventQuery {
+			queries = append(queries, e)
+		}
+	}
+	assert.Len(t, queries, 3)
+	assert.Equal(t, []driver.Value{int64(2), int64(2), int64(3)}, queries[0].Args)
+	assert.Equal(t, []driver.Value{int64(1), int64(9)}, queries[1].Args)
+	assert.Equal(t, []driver.Value{"Tom", int64(1), int64(2)}, queries[2].Args)
+
+	// fail fast
+	fake.Reset()
+	expect(fake)
+	opt.FailOnMissingForeignKey = true
+	_, err = BatchInsertReport(db, "pets", records, opt)
+	var fkErr *ForeignKeyError
+	assert.True(t, errors.As(err, &fkErr))
+	assert.Equal(t, map[int][]ColumnName{
+		1: {"owner_id"},
+		2: {"group_id", "owner_id"},
+	}, fkErr.Rejected)
+	assert.Equal(t, 2, fake.Count(pqtest.EventQuery))
+	assert.Equal(t, 1, fake.Count(pqtest.EventRollback))
+}
@@ -0,0 +1,148 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// QueryKind ...
+type QueryKind string
+
+// Kinds of queries observed by hooks.
+const (
+	QueryKindExec     QueryKind = "exec"
+	QueryKindQuery    QueryKind = "query"
+	QueryKindBegin    QueryKind = "begin"
+	QueryKindCommit   QueryKind = "commit"
+	QueryKindRollback QueryKind = "rollback"
+)
+
+// QueryEvent describes a finished statement or transaction boundary.
+type QueryEvent struct {
+	Kind     QueryKind
+	SQL      string
+	NumArgs  int
+	Duration time.Duration
+
+	// Rows returned by a query or affected by a statement, or -1 if unknown.
+	RowsAffected int64
+
+	Err error
+}
+
+// Hook observes statements run by helpers of this package, i.e. `Exec`, `Select`, cursors,
+// and inserting, upserting, copying, updating and deleting records, as well as transactions begun by them, e.g. `WithTransaction`.
+// Statements run directly on a `*sql.DB` or `*sql.Tx`, advisory locks and notifications are not observed.
+// Hooks are called synchronously and should return quickly.
+type Hook interface {
+	AfterQuery(ctx context.Context, event QueryEvent)
+}
+
+// HookFunc ...
+type HookFunc func(ctx context.Context, event QueryEvent)
+
+// AfterQuery implements `Hook`.
+func (f HookFunc) AfterQuery(ctx context.Context, event QueryEvent) {
+	f(ctx, event)
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hook
+)
+
+// AddHook ...
+func AddHook(h Hook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// RemoveHooks ...
+func RemoveHooks() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = nil
+}
+
+func observe(ctx context.Context, kind QueryKind, query string, numArgs int, start time.Time, rowsAffected int64, err error) {
+	hooksMu.RLock()
+	hs := hooks
+	hooksMu.RUnlock()
+	if len(hs) == 0 {
+		return
+	}
+
+	event := QueryEvent{
+		Kind:         kind,
+		SQL:          query,
+		NumArgs:      numArgs,
+		Duration:     time.Since(start),
+		RowsAffected: rowsAffected,
+		Err:          err,
+	}
+	for _, h := range hs {
+		h.AfterQuery(ctx, event)
+	}
+}
+
+// execObserved runs a statement and tells hooks.
+func execObserved(ctx context.Context, q Execer, query string, args []interface{}) (res sql.Result, err error) {
+	start := time.Now()
+	var affected int64 = -1
+	res, err = q.ExecContext(ctx, query, args...)
+	if err == nil {
+		if n, e := res.RowsAffected(); e == nil {
+			affected = n
+		}
+	}
+	observe(ctx, QueryKindExec, query, len(args), start, affected, err)
+	return
+}
+
+// txBeginner is implemented by both `*sql.DB` and `*sql.Conn`.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func beginTx(ctx context.Context, b txBeginner, opts *sql.TxOptions) (tx *sql.Tx, err error) {
+	start := time.Now()
+	tx, err = b.BeginTx(ctx, opts)
+	observe(ctx, QueryKindBegin, "BEGIN", 0, start, -1, err)
+	return
+}
+
+func commitTx(ctx context.Context, tx *sql.Tx) (err error) {
+	start := time.Now()
+	err = tx.Commit()
+	observe(ctx, QueryKindCommit, "COMMIT", 0, start, -1, err)
+	return
+}
+
+func rollbackTx(ctx context.Context, tx *sql.Tx) (err error) {
+	start := time.Now()
+	err = tx.Rollback()
+	if err == sql.ErrTxDone {
+		// already committed or rolled back, e.g. when `ctx` is done
+		return
+	}
+	observe(ctx, QueryKindRollback, "ROLLBACK", 0, start, -1, err)
+	return
+}
+
+// SlowQueryLogger logs queries taking no less than `threshold`, as well as failed ones.
+func SlowQueryLogger(threshold time.Duration) Hook {
+	return HookFunc(func(ctx context.Context, event QueryEvent) {
+		if event.Err != nil {
+			glog.Warningf("%s failed in %v: %v: %s", event.Kind, event.Duration, event.Err, event.SQL)
+			return
+		}
+		if event.Duration >= threshold {
+			glog.Warningf("slow %s in %v with %d args and %d rows: %s", event.Kind, event.Duration, event.NumArgs, event.RowsAffected, event.SQL)
+		}
+	})
+}
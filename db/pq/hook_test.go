@@ -0,0 +1,101 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHook(t *testing.T) {
+	var events []QueryEvent
+	AddHook(HookFunc(func(ctx context.Context, event QueryEvent) {
+		events = append(events, event)
+	}))
+	defer RemoveHooks()
+
+	db, fake := pqtest.New()
+	fake.Expect(`UPDATE users`).WillReturnResult(3)
+
+	b := NewBatchExec()
+	b.Add(`UPDATE users SET age = $1`).SetArgs(18)
+	assert.NoError(t, b.Exec(db))
+
+	var kinds []QueryKind
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []QueryKind{QueryKindBegin, QueryKindExec, QueryKindCommit}, kinds)
+	assert.Equal(t, `UPDATE users SET age = $1`, events[1].SQL)
+	assert.Equal(t, 1, events[1].NumArgs)
+	assert.Equal(t, int64(3), events[1].RowsAffected)
+	assert.NoError(t, events[1].Err)
+
+	events = nil
+	fake.Expect(`DELETE FROM users`).WillReturnError(fmt.Errorf("boom"))
+
+	b = NewBatchExec()
+	b.Add(`DELETE FROM users`)
+	assert.Error(t, b.Exec(db))
+
+	kinds = nil
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	assert.Equal(t, []QueryKind{QueryKindBegin, QueryKindExec, QueryKindRollback}, kinds)
+	assert.EqualError(t, events[1].Err, "boom")
+}
+
+func TestHookHelpers(t *testing.T) {
+	var events []QueryEvent
+	AddHook(HookFunc(func(ctx context.Context, event QueryEvent) {
+		events = append(events, event)
+	}))
+	defer RemoveHooks()
+
+	db, fake := pqtest.New()
+	fake.Expect(`^SELECT name FROM users`).WillReturnRows([]string{"name"}, []driver.Value{"Tom"}, []driver.Value{"Amy"})
+	fake.Expect(`^UPDATE users`).WillReturnResult(1)
+	fake.Expect(`^COPY`).WillReturnResult(1).Always()
+
+	var names []string
+	assert.NoError(t, SelectContext(context.Background(), db, &names, `SELECT name FROM users WHERE age > $1`, 18))
+	_, err := Update(db, "users", updateRecord{ID: 1, Name: "Tom"}, UpdateOption{KeyColumns: []ColumnName{"id"}})
+	assert.NoError(t, err)
+	_, err = BulkCopy(db, "users", []Record{insertRecord{Name: "Tom"}})
+	assert.NoError(t, err)
+
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s %d %d", e.Kind, e.NumArgs, e.RowsAffected))
+	}
+	assert.Equal(t, []string{"query 1 2", "exec 2 1", "begin 0 -1", "exec 0 1", "commit 0 -1"}, got)
+	assert.Equal(t, `COPY "users" ("name") FROM STDIN`, events[3].SQL)
+}
+
+func TestMetricsHook(t *testing.T) {
+	m := NewMetricsHook("", []float64{1, 0.1})
+	m.AfterQuery(context.Background(), QueryEvent{Kind: QueryKindExec, Duration: 50 * time.Millisecond, RowsAffected: 2})
+	m.AfterQuery(context.Background(), QueryEvent{Kind: QueryKindExec, Duration: 500 * time.Millisecond, RowsAffected: 3})
+	m.AfterQuery(context.Background(), QueryEvent{Kind: QueryKindExec, Duration: 2 * time.Second, RowsAffected: -1, Err: fmt.Errorf("boom")})
+
+	var sb strings.Builder
+	_, err := m.WriteTo(&sb)
+	assert.NoError(t, err)
+
+	out := sb.String()
+	assert.Contains(t, out, "pq_queries_total{kind=\"exec\",status=\"error\"} 1\n")
+	assert.Contains(t, out, "pq_queries_total{kind=\"exec\",status=\"ok\"} 2\n")
+	assert.Contains(t, out, "pq_query_rows_total{kind=\"exec\"} 5\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_bucket{kind=\"exec\",status=\"ok\",le=\"0.1\"} 1\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_bucket{kind=\"exec\",status=\"ok\",le=\"1\"} 2\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_bucket{kind=\"exec\",status=\"error\",le=\"1\"} 0\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_bucket{kind=\"exec\",status=\"error\",le=\"+Inf\"} 1\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_sum{kind=\"exec\",status=\"ok\"} 0.55\n")
+	assert.Contains(t, out, "pq_query_duration_seconds_count{kind=\"exec\",status=\"ok\"} 2\n")
+}
@@ -1,8 +1,11 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -13,6 +16,15 @@ import (
 // TableName ...
 type TableName string
 
+// split tells the schema of a qualified name, e.g. "public" of "public.users", which is empty otherwise, and the name of the table.
+func (t TableName) split() (schema, name string) {
+	name = string(t)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		schema, name = name[:i], name[i+1:]
+	}
+	return
+}
+
 // ColumnName ...
 type ColumnName string
 
@@ -38,11 +50,23 @@ type InsertOption struct {
 	// Key is the field of inserting table.
 	// Value is the field of reference table.
 	// If provided, checks are performed before inserting.
+	// Records referencing missing rows are skipped, which can be reported by `BatchInsertReport`.
 	ForeignKeys map[ColumnName]Column
 
+	// Fail the whole insertion with a `*ForeignKeyError` instead of skipping records referencing missing rows.
+	FailOnMissingForeignKey bool
+
 	// Columns whose value is empty should also be inserted instead of omitted.
 	// For example, for an NOT-NULL integer column whose being 0 is perfect valid, we should add it to this option.
 	KeepEmptyValueColums []ColumnName
+
+	// If provided, the `ON CONFLICT` clause is built from it, and `OnConflict` must be left empty.
+	Upsert *Upsert
+
+	// Columns returned for inserted rows by `BatchInsertReturning`, which defaults to `id`.
+	// `*` returns all columns, or all columns of the struct when scanning into structs.
+	// Other functions return ids only, and reject it.
+	Returning []ColumnName
 }
 
 // BatchInsert ...
@@ -50,10 +74,20 @@ func BatchInsert(dbase *sql.DB, table TableName, records []Record) (ids []int, e
 	return BatchInsertWithOption(dbase, table, records, InsertOption{})
 }
 
+// BatchInsertContext ...
+func BatchInsertContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record) (ids []int, err error) {
+	return BatchInsertWithOptionContext(ctx, dbase, table, records, InsertOption{})
+}
+
 // BatchInsertWithOption ...
 func BatchInsertWithOption(dbase *sql.DB, table TableName, records []Record, opt InsertOption) (ids []int, err error) {
-	err = WithTransaction(dbase, func(tx *sql.Tx) (abort bool, err error) {
-		ids, err = BatchInsertTransaction(tx, table, records, opt)
+	return BatchInsertWithOptionContext(context.Background(), dbase, table, records, opt)
+}
+
+// BatchInsertWithOptionContext ...
+func BatchInsertWithOptionContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt InsertOption) (ids []int, err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		ids, err = BatchInsertTransactionContext(ctx, tx, table, records, opt)
 		if opt.Abort != nil {
 			abort = *opt.Abort
 		}
@@ -71,27 +105,96 @@ const PlaceholderLimit = 65535
 
 // BatchInsertTransaction ...
 func BatchInsertTransaction(tx *sql.Tx, table TableName, records []Record, opt InsertOption) (ids []int, err error) {
+	return BatchInsertTransactionContext(context.Background(), tx, table, records, opt)
+}
+
+// BatchInsertTransactionContext stops inserting as soon as `ctx` is done, checked between batches as well as by each statement.
+func BatchInsertTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt InsertOption) (ids []int, err error) {
+	if len(opt.Returning) > 0 {
+		err = fmt.Errorf("opt.Returning is only supported by BatchInsertReturning")
+		glog.Error(err)
+		return
+	}
 	if len(records) == 0 {
 		return
 	}
 
+	columns, err := insertColumns(table, records, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	// batches of the same size make the same query, thus share one prepared statement
+	stmts := newStmtCache(tx)
+	defer stmts.close()
+
+	var offset int
+	err = forEachBatch(ctx, records, columns, opt, func(recs []Record) error {
+		if opt.FailOnMissingForeignKey {
+			missing, e := checkForeignKeys(ctx, stmts, recs, opt)
+			if e != nil {
+				return e
+			}
+			if len(missing) > 0 {
+				rejected := make(map[int][]ColumnName)
+				for i, cols := range missing {
+					rejected[offset+i] = cols
+				}
+				return &ForeignKeyError{Rejected: rejected}
+			}
+		}
+		offset += len(recs)
+
+		currIDs, e := insertBatch(ctx, stmts, table, recs, columns, opt)
+		if e != nil {
+			return e
+		}
+		ids = append(ids, currIDs...)
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	return
+}
+
+// insertColumns collects the union of columns of all records, in the order of struct fields of the first record,
+// followed by sorted columns only found in records of other types, so that the same records always make the same query.
+func insertColumns(table TableName, records []Record, opt InsertOption) (columns []string, err error) {
 	colSet := make(map[string]bool)
 	for _, rec := range records {
-		cols := mapColumn(rec, opt)
+		cols := mapColumn(table, rec, opt)
 		for col := range cols {
 			colSet[col] = true
 		}
 	}
 	if len(colSet) == 0 {
 		err = fmt.Errorf("missing columns")
-		glog.Error(err)
 		return
 	}
-	var columns []string
+
+	for _, f := range structColumns(reflect.TypeOf(records[0])) {
+		if colSet[f.column] {
+			columns = append(columns, f.column)
+			delete(colSet, f.column)
+		}
+	}
+	var rest []string
 	for col := range colSet {
-		columns = append(columns, col)
+		rest = append(rest, col)
 	}
+	sort.Strings(rest)
+	columns = append(columns, rest...)
+
+	return
+}
 
+// forEachBatch splits records into batches fitting in `PlaceholderLimit` and calls `insert` on each of them,
+// taking care of the callbacks and the abort flag in `opt`, as well as cancellation of `ctx`.
+func forEachBatch(ctx context.Context, records []Record, columns []string, opt InsertOption, insert func(recs []Record) error) (err error) {
 	batchSize := PlaceholderLimit / len(columns)
 	numBatch := len(records) / batchSize
 	if len(records)%batchSize > 0 {
@@ -110,6 +213,9 @@ func BatchInsertTransaction(tx *sql.Tx, table TableName, records []Record, opt I
 			glog.Infof("inserting aborted")
 			break
 		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
 
 		glog.Infof("inserting batch %v/%v", bidx+1, numBatch)
 
@@ -118,15 +224,10 @@ func BatchInsertTransaction(tx *sql.Tx, table TableName, records []Record, opt I
 		if n > len(records) {
 			n = len(records)
 		}
-		recs := records[m:n]
 
-		currIDs, e := insertBatch(tx, table, recs, columns, opt)
-		if e != nil {
-			err = e
-			glog.Error(err)
+		if err = insert(records[m:n]); err != nil {
 			return
 		}
-		ids = append(ids, currIDs...)
 
 		if opt.BatchCallback != nil {
 			opt.BatchCallback(bidx)
@@ -136,7 +237,7 @@ func BatchInsertTransaction(tx *sql.Tx, table TableName, records []Record, opt I
 	return
 }
 
-func insertBatch(tx *sql.Tx, table TableName, records []Record, columns []string, opt InsertOption) (ids []int, err error) {
+func insertBatch(ctx context.Context, stmts *stmtCache, table TableName, records []Record, columns []string, opt InsertOption) (ids []int, err error) {
 	query, args, empty, err := MakeBatchInsertQuery(table, records, columns, opt)
 	if err != nil {
 		glog.Error(err)
@@ -146,17 +247,39 @@ func insertBatch(tx *sql.Tx, table TableName, records []Record, columns []string
 		return
 	}
 
+	start := time.Now()
+	var affected int64 = -1
+	defer func() {
+		kind := QueryKindQuery
+		if opt.NoID {
+			kind = QueryKindExec
+		} else {
+			affected = int64(len(ids))
+		}
+		observe(ctx, kind, query, len(args), start, affected, err)
+	}()
+
+	stt, err := stmts.prepare(ctx, query)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
 	// exec
 	if opt.NoID {
-		_, err = tx.Exec(query, args...)
-		if err != nil {
+		res, e := stt.ExecContext(ctx, args...)
+		if e != nil {
+			err = e
 			glog.Error(err)
 			return
 		}
+		if n, e := res.RowsAffected(); e == nil {
+			affected = n
+		}
 		return
 	}
 
-	rows, err := tx.Query(query, args...)
+	rows, err := stt.QueryContext(ctx, args...)
 	if err != nil {
 		glog.Error(err)
 		return
@@ -171,10 +294,47 @@ func insertBatch(tx *sql.Tx, table TableName, records []Record, columns []string
 		}
 		ids = append(ids, id)
 	}
+	if err = rows.Err(); err != nil {
+		glog.Error(err)
+		return
+	}
+
+	return
+}
+
+// stmtCache prepares each distinct query only once in a transaction.
+type stmtCache struct {
+	tx    *sql.Tx
+	stmts map[string]*sql.Stmt
+}
 
+func newStmtCache(tx *sql.Tx) *stmtCache {
+	c := &stmtCache{
+		tx:    tx,
+		stmts: make(map[string]*sql.Stmt),
+	}
+	return c
+}
+
+func (c *stmtCache) prepare(ctx context.Context, query string) (stt *sql.Stmt, err error) {
+	if stt, ok := c.stmts[query]; ok {
+		return stt, nil
+	}
+	stt, err = c.tx.PrepareContext(ctx, query)
+	if err != nil {
+		return
+	}
+	c.stmts[query] = stt
 	return
 }
 
+func (c *stmtCache) close() {
+	for _, stt := range c.stmts {
+		stt.Close()
+	}
+	c.stmts = make(map[string]*sql.Stmt)
+}
+
 // MakeBatchInsertQuery ...
 func MakeBatchInsertQuery(table TableName, records []Record, columns []string, opt InsertOption) (query string, args []interface{}, empty bool, err error) {
 	if len(columns) == 0 {
@@ -185,7 +345,7 @@ func MakeBatchInsertQuery(table TableName, records []Record, columns []string, o
 
 	var values []map[string]interface{}
 	for _, rec := range records {
-		cols := mapColumn(rec, opt)
+		cols := mapColumn(table, rec, opt)
 		values = append(values, cols)
 	}
 	if len(values) == 0 {
@@ -196,36 +356,35 @@ func MakeBatchInsertQuery(table TableName, records []Record, columns []string, o
 	// will use different way to handle foreign key case
 	hasForeignKey := len(opt.ForeignKeys) > 0
 
-	// make placeholders and args
+	// values are selected from `VALUES` in foreign key case, thus should be typed
 	var rows []string
+	if hasForeignKey {
+		// filtered out by checking foreign keys
+		rows = append(rows, typedValuesRow(table, columns))
+	}
+
+	// make placeholders and args
 	for _, vs := range values {
 		var phds []string
 		for _, f := range columns {
-			v := vs[f]
-
-			var suffix string
-			if hasForeignKey {
-				switch v.(type) {
-				case int, int8, int16, int32, uint, uint8, uint16, uint32, uint64, *int, *int8, *int16, *int32, *int64, *uint, *uint8, *uint16, *uint32:
-					suffix = "::integer"
-				case int64, *uint64:
-					suffix = "::bigint"
-				case time.Time, *time.Time:
-					suffix = "::timestamp without time zone"
-				}
-			}
-
-			args = append(args, v)
-			phds = append(phds, fmt.Sprintf("$%d%s", len(args), suffix))
+			args = append(args, vs[f])
+			phds = append(phds, fmt.Sprintf("$%d", len(args)))
 		}
 		row := "(" + strings.Join(phds, ",") + ")"
 		rows = append(rows, row)
 	}
-	onConflict := " " + opt.OnConflict + " "
+	onConflict, err := opt.onConflictClause(table, columns)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	onConflict = " " + onConflict + " "
 
 	returning := "RETURNING id"
 	if opt.NoID {
 		returning = ""
+	} else if len(opt.Returning) > 0 {
+		returning = "RETURNING " + joinColumnNames(opt.Returning)
 	}
 
 	// make sql
@@ -244,8 +403,16 @@ func MakeBatchInsertQuery(table TableName, records []Record, columns []string, o
 	// make query checking foreign keys
 	// https://stackoverflow.com/a/45229846
 
+	// iterate in a fixed order for the query to be stable
+	var fkFields []string
+	for field := range opt.ForeignKeys {
+		fkFields = append(fkFields, string(field))
+	}
+	sort.Strings(fkFields)
+
 	var existClauses []string
-	for field, ref := range opt.ForeignKeys {
+	for _, field := range fkFields {
+		ref := opt.ForeignKeys[ColumnName(field)]
 		clause := fmt.Sprintf(`(
 			EXISTS (
 				SELECT 1 FROM %s AS ref WHERE ref.%s = vs.%s
@@ -278,9 +445,35 @@ func MakeBatchInsertQuery(table TableName, records []Record, columns []string, o
 	return
 }
 
-func mapColumn(r Record, opt InsertOption) map[string]interface{} {
+// typedNull is a NULL of the type of `column` in `table`, e.g.
+//    (NULL::users).id
+func typedNull(table TableName, column string) string {
+	return fmt.Sprintf("(NULL::%s).%s", table, column)
+}
+
+// typedValuesRow makes the first row of a `VALUES` list, whose NULLs are typed by `columns` of `table`,
+// since otherwise PostgreSQL treats placeholders in `VALUES` as text, which can not be compared with or assigned to e.g. uuid or enum columns.
+// The row matches no key by equality, and should be filtered out otherwise.
+func typedValuesRow(table TableName, columns []string) string {
+	var nulls []string
+	for _, c := range columns {
+		nulls = append(nulls, typedNull(table, c))
+	}
+	return "(" + strings.Join(nulls, ",") + ")"
+}
+
+// mapColumn maps a record to insert into `table`, filling conventional columns if any.
+func mapColumn(table TableName, r Record, opt InsertOption) map[string]interface{} {
+	values := mapColumnKeeping(r, opt.KeepEmptyValueColums)
+	if c := conventionsOf(table); c != nil {
+		c.fillInsert(values, time.Now())
+	}
+	return values
+}
+
+func mapColumnKeeping(r Record, keepEmptyValueColums []ColumnName) map[string]interface{} {
 	var keepEmptyValueCols []string
-	for _, c := range opt.KeepEmptyValueColums {
+	for _, c := range keepEmptyValueColums {
 		keepEmptyValueCols = append(keepEmptyValueCols, string(c))
 	}
 
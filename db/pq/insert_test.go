@@ -0,0 +1,129 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type insertRecord struct {
+	Name    string `db:"name"`
+	Age     int    `db:"age"`
+	Email   string `db:"email"`
+	OwnerID int    `db:"owner_id"`
+	GroupID int    `db:"group_id"`
+}
+
+func TestInsertColumnsOrder(t *testing.T) {
+	records := []Record{
+		insertRecord{Email: "tom@example.com", Age: 3},
+		insertRecord{Name: "Jerry", Email: "jerry@example.com"},
+	}
+	for i := 0; i < 10; i++ {
+		columns, err := insertColumns("users", records, InsertOption{})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"name", "age", "email"}, columns)
+	}
+
+	// columns of other types follow in sorted order
+	records = append(records, struct {
+		Zip  string `db:"zip"`
+		City string `db:"city"`
+	}{Zip: "200000", City: "Shanghai"})
+	columns, err := insertColumns("users", records, InsertOption{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name", "age", "email", "city", "zip"}, columns)
+}
+
+func TestMakeBatchInsertQuery(t *testing.T) {
+	records := []Record{
+		insertRecord{Name: "Tom", Age: 3},
+		insertRecord{Name: "Jerry"},
+	}
+
+	query, args, empty, err := MakeBatchInsertQuery("users", records, []string{"name", "age"}, InsertOption{})
+	assert.Nil(t, err)
+	assert.False(t, empty)
+	assert.Equal(t, "INSERT INTO users (name,age) VALUES ($1,$2),($3,$4)    RETURNING id", query)
+	assert.Equal(t, []interface{}{"Tom", 3, "Jerry", nil}, args)
+
+	opt := InsertOption{
+		NoID: true,
+		ForeignKeys: map[ColumnName]Column{
+			"owner_id": {Table: "users", Name: "id"},
+			"group_id": {Table: "groups", Name: "id"},
+		},
+	}
+	records = []Record{
+		insertRecord{Name: "Tom", OwnerID: 1, GroupID: 2},
+		insertRecord{Name: "Jerry", GroupID: 2},
+	}
+	first, _, _, err := MakeBatchInsertQuery("pets", records, []string{"name", "owner_id", "group_id"}, opt)
+	assert.Nil(t, err)
+	assert.Contains(t, first, "((NULL::pets).name,(NULL::pets).owner_id,(NULL::pets).group_id),($1,$2,$3),($4,$5,$6)")
+	for i := 0; i < 10; i++ {
+		query, _, _, err := MakeBatchInsertQuery("pets", records, []string{"name", "owner_id", "group_id"}, opt)
+		assert.Nil(t, err)
+		assert.Equal(t, first, query)
+	}
+}
+
+func TestResolveReturning(t *testing.T) {
+	assert.Equal(t, []ColumnName{"id"}, resolveReturning(nil, reflect.TypeOf(0)))
+	assert.Equal(t, []ColumnName{"uuid"}, resolveReturning([]ColumnName{"uuid"}, reflect.TypeOf("")))
+	assert.Equal(t, []ColumnName{"*"}, resolveReturning([]ColumnName{"*"}, reflect.TypeOf(map[string]interface{}{})))
+	assert.Equal(t, []ColumnName{"name", "age", "email", "owner_id", "group_id"}, resolveReturning([]ColumnName{"*"}, reflect.TypeOf(&insertRecord{})))
+
+	query, _, _, err := MakeBatchInsertQuery("users", []Record{insertRecord{Name: "Tom"}}, []string{"name"}, InsertOption{Returning: []ColumnName{"tenant_id", "slug"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "INSERT INTO users (name) VALUES ($1)    RETURNING tenant_id,slug", query)
+}
+
+func TestBatchInsertWithOptionReturning(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^INSERT INTO users`).WillReturnRows([]string{"tenant_id", "slug"}, []driver.Value{int64(1), "tom"})
+
+	// ids only, as other columns can not be scanned into them
+	_, err := BatchInsertWithOption(db, "users", []Record{insertRecord{Name: "Tom"}}, InsertOption{Returning: []ColumnName{"tenant_id", "slug"}})
+	assert.EqualError(t, err, "opt.Returning is only supported by BatchInsertReturning")
+	assert.Equal(t, 0, fake.Count(pqtest.EventQuery))
+
+	var keys []struct {
+		TenantID int    `db:"tenant_id"`
+		Slug     string `db:"slug"`
+	}
+	err = BatchInsertReturning(db, "users", []Record{insertRecord{Name: "Tom"}}, InsertOption{Returning: []ColumnName{"tenant_id", "slug"}}, &keys)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, "tom", keys[0].Slug)
+}
+
+func TestBatchInsertContextCanceled(t *testing.T) {
+	db, fake := pqtest.New()
+
+	// one column makes batches of `PlaceholderLimit` records
+	records := make([]Record, PlaceholderLimit+1)
+	for i := range records {
+		records[i] = insertRecord{Name: "Tom"}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var batches []int
+	_, err := BatchInsertWithOptionContext(ctx, db, "users", records, InsertOption{
+		NoID: true,
+		BatchCallback: func(batchIndex int) {
+			batches = append(batches, batchIndex)
+			cancel()
+		},
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []int{0}, batches)
+
+	// the second batch is never sent, and nothing is committed
+	assert.Len(t, fake.Statements(), 1)
+	assert.Equal(t, 0, fake.Count(pqtest.EventCommit))
+}
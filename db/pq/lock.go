@@ -0,0 +1,163 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"hash/fnv"
+
+	"github.com/golang/glog"
+)
+
+// LockKey hashes a name, e.g. of a job, into an advisory lock key.
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// AdvisoryLock is a session-level advisory lock held on a dedicated connection,
+// which is released by `Release`, or by PostgreSQL when the connection is lost.
+type AdvisoryLock struct {
+	conn *sql.Conn
+	key  int64
+}
+
+// AcquireAdvisoryLock waits for the lock of `key` until `ctx` is done, e.g. by `context.WithTimeout`.
+func AcquireAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (lock *AdvisoryLock, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		glog.Error(err)
+		// the lock may be granted right before `ctx` is done, thus unlock anyway, which is a no-op otherwise
+		unlock(conn, key)
+		return
+	}
+
+	lock = &AdvisoryLock{
+		conn: conn,
+		key:  key,
+	}
+	return
+}
+
+// TryAdvisoryLock takes the lock of `key` without waiting, and returns nil if it is held by others.
+func TryAdvisoryLock(ctx context.Context, db *sql.DB, key int64) (lock *AdvisoryLock, err error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	var locked bool
+	if err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		glog.Error(err)
+		conn.Close()
+		return
+	}
+	if !locked {
+		conn.Close()
+		return
+	}
+
+	lock = &AdvisoryLock{
+		conn: conn,
+		key:  key,
+	}
+	return
+}
+
+// Release unlocks and returns the connection to the pool.
+// If unlocking fails, the connection is discarded instead, closing the session still holding the lock.
+func (l *AdvisoryLock) Release() (err error) {
+	return unlock(l.conn, l.key)
+}
+
+// unlock releases the lock of `key` held by `conn`, as `Release` does.
+func unlock(conn *sql.Conn, key int64) (err error) {
+	defer conn.Close()
+
+	// use a fresh context to unlock even if the one locking is done
+	if _, err = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key); err != nil {
+		glog.Error(err)
+		// a bad connection is closed rather than returned to the pool
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return
+	}
+	return
+}
+
+// WithAdvisoryLock runs `fn` while holding the session-level lock of `key`, waiting for it until `ctx` is done.
+// Unlike `WithAdvisoryLockTransaction`, `fn` is free to use many transactions, e.g. by `WithTransaction`.
+func WithAdvisoryLock(ctx context.Context, db *sql.DB, key int64, fn func() error) (err error) {
+	lock, err := AcquireAdvisoryLock(ctx, db, key)
+	if err != nil {
+		return
+	}
+	defer lock.Release()
+
+	return fn()
+}
+
+// WithTryAdvisoryLock runs `fn` only if the session-level lock of `key` is free, and tells whether it is run,
+// e.g. for only one of many workers to run a cron job.
+func WithTryAdvisoryLock(ctx context.Context, db *sql.DB, key int64, fn func() error) (locked bool, err error) {
+	lock, err := TryAdvisoryLock(ctx, db, key)
+	if err != nil || lock == nil {
+		return
+	}
+	defer lock.Release()
+
+	locked = true
+	err = fn()
+	return
+}
+
+// AdvisoryLockTx waits for the transaction-level lock of `key` until `ctx` is done.
+// The lock is released when the transaction ends.
+func AdvisoryLockTx(ctx context.Context, tx *sql.Tx, key int64) (err error) {
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, key); err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// TryAdvisoryLockTx takes the transaction-level lock of `key` without waiting, and tells whether it is taken.
+func TryAdvisoryLockTx(ctx context.Context, tx *sql.Tx, key int64) (locked bool, err error) {
+	if err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, key).Scan(&locked); err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// WithAdvisoryLockTransaction runs `queries` as `WithTransactionContext` does, holding the transaction-level lock of `key`,
+// for which it waits until `ctx` is done.
+func WithAdvisoryLockTransaction(ctx context.Context, db *sql.DB, opts *sql.TxOptions, key int64, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	return WithTransactionContext(ctx, db, opts, func(tx *sql.Tx) (bool, error) {
+		if err := AdvisoryLockTx(ctx, tx, key); err != nil {
+			return false, err
+		}
+		return queries(tx)
+	})
+}
+
+// WithTryAdvisoryLockTransaction runs `queries` as `WithTransactionContext` does, only if the transaction-level lock of `key` is free,
+// and tells whether it is run.
+func WithTryAdvisoryLockTransaction(ctx context.Context, db *sql.DB, opts *sql.TxOptions, key int64, queries func(tx *sql.Tx) (bool, error)) (locked bool, err error) {
+	err = WithTransactionContext(ctx, db, opts, func(tx *sql.Tx) (bool, error) {
+		ok, err := TryAdvisoryLockTx(ctx, tx, key)
+		if err != nil || !ok {
+			// nothing is done, thus abort
+			return true, err
+		}
+		locked = true
+		return queries(tx)
+	})
+	return
+}
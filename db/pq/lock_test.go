@@ -0,0 +1,87 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTryAdvisoryLock(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	key := LockKey("daily-report")
+
+	fake.Expect(`pg_try_advisory_lock`).WillReturnRows([]string{"locked"}, []driver.Value{false})
+	var run bool
+	locked, err := WithTryAdvisoryLock(ctx, db, key, func() error {
+		run = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.False(t, locked)
+	assert.False(t, run)
+	assert.Equal(t, []string{`SELECT pg_try_advisory_lock($1)`}, fake.Statements())
+
+	fake.Reset()
+	fake.Expect(`pg_try_advisory_lock`).WillReturnRows([]string{"locked"}, []driver.Value{true})
+	locked, err = WithTryAdvisoryLock(ctx, db, key, func() error {
+		run = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.True(t, run)
+	assert.Equal(t, []string{`SELECT pg_try_advisory_lock($1)`, `SELECT pg_advisory_unlock($1)`}, fake.Statements())
+	assert.Equal(t, key, fake.Events()[len(fake.Events())-1].Args[0])
+}
+
+func TestWithTryAdvisoryLockTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+
+	fake.Expect(`pg_try_advisory_xact_lock`).WillReturnRows([]string{"locked"}, []driver.Value{false})
+	locked, err := WithTryAdvisoryLockTransaction(ctx, db, nil, LockKey("daily-report"), func(tx *sql.Tx) (bool, error) {
+		_, err := tx.Exec(`UPDATE reports SET done = true`)
+		return false, err
+	})
+	assert.NoError(t, err)
+	assert.False(t, locked)
+	assert.Equal(t, []string{`SELECT pg_try_advisory_xact_lock($1)`}, fake.Statements())
+	assert.Equal(t, 1, fake.Count(pqtest.EventRollback))
+
+	fake.Reset()
+	fake.Expect(`pg_try_advisory_xact_lock`).WillReturnRows([]string{"locked"}, []driver.Value{true})
+	locked, err = WithTryAdvisoryLockTransaction(ctx, db, nil, LockKey("daily-report"), func(tx *sql.Tx) (bool, error) {
+		_, err := tx.Exec(`UPDATE reports SET done = true`)
+		return false, err
+	})
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.Equal(t, []string{`SELECT pg_try_advisory_xact_lock($1)`, `UPDATE reports SET done = true`}, fake.Statements())
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+}
+
+func TestAdvisoryLockUnlock(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	key := LockKey("daily-report")
+
+	// a failed lock is still unlocked, since it may be granted right before the context is done
+	fake.Expect(`^SELECT pg_advisory_lock`).WillReturnError(context.Canceled)
+	_, err := AcquireAdvisoryLock(ctx, db, key)
+	assert.Error(t, err)
+	assert.Equal(t, []string{`SELECT pg_advisory_lock($1)`, `SELECT pg_advisory_unlock($1)`}, fake.Statements())
+	assert.Equal(t, 1, db.Stats().OpenConnections)
+
+	// the connection possibly holding the lock is discarded rather than pooled
+	fake.Reset()
+	lock, err := AcquireAdvisoryLock(ctx, db, key)
+	assert.NoError(t, err)
+	fake.Expect(`pg_advisory_unlock`).WillReturnError(context.DeadlineExceeded)
+	assert.Error(t, lock.Release())
+	assert.Equal(t, 0, db.Stats().OpenConnections)
+}
@@ -0,0 +1,164 @@
+package pq
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultDurationBuckets are upper bounds of query durations in seconds, the same as Prometheus' default buckets.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// MetricsHook counts queries and observes their durations by kind and status, exporting them in the Prometheus text format, e.g.
+//    metrics := NewMetricsHook("myapp_pq", nil)
+//    AddHook(metrics)
+//    http.Handle("/metrics", metrics)
+// which exports
+//    myapp_pq_queries_total{kind="exec",status="ok"} 42
+//    myapp_pq_query_rows_total{kind="exec"} 420
+//    myapp_pq_query_duration_seconds_bucket{kind="exec",status="ok",le="0.005"} 40
+//    ...
+type MetricsHook struct {
+	namespace string
+	buckets   []float64
+
+	mu     sync.Mutex
+	series map[metricKey]*metricSeries
+}
+
+type metricKey struct {
+	kind   QueryKind
+	status string
+}
+
+type metricSeries struct {
+	count uint64
+	sum   float64
+	rows  int64
+
+	// cumulative counts of each bucket
+	buckets []uint64
+}
+
+// NewMetricsHook prefixes metric names with `namespace`, which is "pq" if empty,
+// and uses `DefaultDurationBuckets` if `buckets` is empty.
+func NewMetricsHook(namespace string, buckets []float64) *MetricsHook {
+	if namespace == "" {
+		namespace = "pq"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	m := &MetricsHook{
+		namespace: namespace,
+		buckets:   buckets,
+		series:    make(map[metricKey]*metricSeries),
+	}
+	return m
+}
+
+// AfterQuery implements `Hook`.
+func (m *MetricsHook) AfterQuery(ctx context.Context, event QueryEvent) {
+	key := metricKey{kind: event.Kind, status: "ok"}
+	if event.Err != nil {
+		key.status = "error"
+	}
+	seconds := event.Duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	s.count++
+	s.sum += seconds
+	if event.RowsAffected > 0 {
+		s.rows += event.RowsAffected
+	}
+	for i, le := range m.buckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// WriteTo writes metrics in the Prometheus text format.
+func (m *MetricsHook) WriteTo(w io.Writer) (n int64, err error) {
+	m.mu.Lock()
+	keys := make([]metricKey, 0, len(m.series))
+	series := make(map[metricKey]metricSeries, len(m.series))
+	for k, s := range m.series {
+		keys = append(keys, k)
+		copied := *s
+		copied.buckets = append([]uint64{}, s.buckets...)
+		series[k] = copied
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	write := func(format string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		var c int
+		c, err = fmt.Fprintf(w, format, args...)
+		n += int64(c)
+	}
+
+	name := m.namespace + "_queries_total"
+	write("# HELP %s Number of queries by kind and status.\n# TYPE %s counter\n", name, name)
+	for _, k := range keys {
+		write("%s{kind=%q,status=%q} %d\n", name, k.kind, k.status, series[k].count)
+	}
+
+	// rows are summed over statuses
+	name = m.namespace + "_query_rows_total"
+	write("# HELP %s Number of rows returned or affected by kind.\n# TYPE %s counter\n", name, name)
+	rows := make(map[QueryKind]int64)
+	var kinds []QueryKind
+	for _, k := range keys {
+		if _, ok := rows[k.kind]; !ok {
+			kinds = append(kinds, k.kind)
+		}
+		rows[k.kind] += series[k].rows
+	}
+	for _, kind := range kinds {
+		write("%s{kind=%q} %d\n", name, kind, rows[kind])
+	}
+
+	name = m.namespace + "_query_duration_seconds"
+	write("# HELP %s Duration of queries by kind and status.\n# TYPE %s histogram\n", name, name)
+	for _, k := range keys {
+		s := series[k]
+		for i, le := range m.buckets {
+			write("%s_bucket{kind=%q,status=%q,le=%q} %d\n", name, k.kind, k.status, strconv.FormatFloat(le, 'g', -1, 64), s.buckets[i])
+		}
+		write("%s_bucket{kind=%q,status=%q,le=\"+Inf\"} %d\n", name, k.kind, k.status, s.count)
+		write("%s_sum{kind=%q,status=%q} %s\n", name, k.kind, k.status, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		write("%s_count{kind=%q,status=%q} %d\n", name, k.kind, k.status, s.count)
+	}
+
+	return
+}
+
+// ServeHTTP serves metrics to be scraped by Prometheus.
+func (m *MetricsHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
@@ -0,0 +1,308 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// DefaultMigrationTable is where applied migrations are recorded.
+const DefaultMigrationTable TableName = "schema_migrations"
+
+// Migration ...
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus ...
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadMigrationsFromDir ...
+func LoadMigrationsFromDir(dir string) ([]Migration, error) {
+	return LoadMigrations(os.DirFS(dir), ".")
+}
+
+// LoadMigrations reads migrations in `dir` of `fsys`, which can be an `embed.FS`.
+// Files are named by version and name, e.g.
+//    0001_create_users.up.sql
+//    0001_create_users.down.sql
+// where the down migration is optional, and other files are ignored.
+func LoadMigrations(fsys fs.FS, dir string) (migrations []Migration, err error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, e := strconv.ParseInt(match[1], 10, 64)
+		if e != nil {
+			err = fmt.Errorf("invalid migration version of %s: %v", entry.Name(), e)
+			glog.Error(err)
+			return
+		}
+		content, e := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if e != nil {
+			err = e
+			glog.Error(err)
+			return
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			err = fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+			glog.Error(err)
+			return
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	for _, m := range byVersion {
+		if m.Up == "" {
+			err = fmt.Errorf("missing up migration of %d_%s", m.Version, m.Name)
+			glog.Error(err)
+			return
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return
+}
+
+// Migrator ...
+type Migrator struct {
+	db         *sql.DB
+	table      TableName
+	migrations []Migration
+}
+
+// NewMigrator ...
+func NewMigrator(db *sql.DB, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("duplicated migration version %d", sorted[i].Version)
+		}
+	}
+
+	m := &Migrator{
+		db:         db,
+		table:      DefaultMigrationTable,
+		migrations: sorted,
+	}
+	return m, nil
+}
+
+// SetTable changes where applied migrations are recorded.
+func (m *Migrator) SetTable(table TableName) *Migrator {
+	m.table = table
+	return m
+}
+
+// Up applies all pending migrations in order, each in its own transaction, and returns the applied ones.
+// Migrations run on the connection holding the lock, thus a pool of a single connection is enough.
+func (m *Migrator) Up(ctx context.Context) (applied []Migration, err error) {
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, e := m.appliedVersions(ctx, conn)
+		if e != nil {
+			return e
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+
+			glog.Infof("applying migration %d_%s", mig.Version, mig.Name)
+			e := withTransaction(ctx, conn, nil, func(tx *sql.Tx) (bool, error) {
+				if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+					return false, fmt.Errorf("migration %d_%s: %v", mig.Version, mig.Name, err)
+				}
+				query := fmt.Sprintf(`INSERT INTO %s (version, name) VALUES ($1, $2)`, m.table)
+				_, err := tx.ExecContext(ctx, query, mig.Version, mig.Name)
+				return false, err
+			})
+			if e != nil {
+				return e
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// Down reverts the latest `steps` applied migrations in reverse order, each in its own transaction, and returns the reverted ones.
+// Nothing is reverted if `steps` is 0, and a negative `steps` is an error.
+func (m *Migrator) Down(ctx context.Context, steps int) (reverted []Migration, err error) {
+	if steps < 0 {
+		err = fmt.Errorf("negative migration steps %d", steps)
+		glog.Error(err)
+		return
+	}
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		done, e := m.appliedVersions(ctx, conn)
+		if e != nil {
+			return e
+		}
+		var versions []int64
+		for v := range done {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		byVersion := make(map[int64]Migration)
+		for _, mig := range m.migrations {
+			byVersion[mig.Version] = mig
+		}
+
+		for _, v := range versions {
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("unknown applied migration %d", v)
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("missing down migration of %d_%s", mig.Version, mig.Name)
+			}
+
+			glog.Infof("reverting migration %d_%s", mig.Version, mig.Name)
+			e := withTransaction(ctx, conn, nil, func(tx *sql.Tx) (bool, error) {
+				if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+					return false, fmt.Errorf("migration %d_%s: %v", mig.Version, mig.Name, err)
+				}
+				query := fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, m.table)
+				_, err := tx.ExecContext(ctx, query, mig.Version)
+				return false, err
+			})
+			if e != nil {
+				return e
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// Status tells whether each known migration is applied, without taking the lock or creating the table,
+// thus all migrations are pending if the table is missing.
+func (m *Migrator) Status(ctx context.Context) (status []MigrationStatus, err error) {
+	var exists bool
+	if err = m.db.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, string(m.table)).Scan(&exists); err != nil {
+		glog.Error(err)
+		return
+	}
+	var done map[int64]time.Time
+	if exists {
+		if done, err = m.appliedVersions(ctx, m.db); err != nil {
+			glog.Error(err)
+			return
+		}
+	}
+
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Migration: mig}
+		s.AppliedAt, s.Applied = done[mig.Version]
+		status = append(status, s)
+	}
+	return
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, q Execer) error {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp with time zone NOT NULL DEFAULT now()
+	)`, m.table)
+	_, err := q.ExecContext(ctx, query)
+	return err
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context, q QueryerContext) (done map[int64]time.Time, err error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`SELECT version, applied_at FROM %s`, m.table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	done = make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return
+		}
+		done[version] = appliedAt
+	}
+	err = rows.Err()
+	return
+}
+
+// withLock holds a session-level advisory lock on the migration table while creating it if missing and running `fn`,
+// so that no two instances migrate at the same time. Both run on `conn`, the connection holding the lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	lock, err := AcquireAdvisoryLock(ctx, m.db, LockKey(string(m.table)))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := m.ensureTable(ctx, lock.conn); err != nil {
+		return err
+	}
+	return fn(lock.conn)
+}
@@ -0,0 +1,111 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_age.up.sql":        {Data: []byte("ALTER TABLE users ADD COLUMN age int")},
+		"migrations/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id serial)")},
+		"migrations/0001_create_users.down.sql": {Data: []byte("DROP TABLE users")},
+		"migrations/README.md":                  {Data: []byte("ignored")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "migrations")
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id serial)", Down: "DROP TABLE users"},
+		{Version: 2, Name: "add_age", Up: "ALTER TABLE users ADD COLUMN age int"},
+	}, migrations)
+
+	fsys["migrations/0003_drop_age.down.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE users ADD COLUMN age int")}
+	_, err = LoadMigrations(fsys, "migrations")
+	assert.NotNil(t, err)
+}
+
+func TestNewMigrator(t *testing.T) {
+	_, err := NewMigrator(nil, []Migration{{Version: 1, Up: "SELECT 1"}, {Version: 1, Up: "SELECT 2"}})
+	assert.NotNil(t, err)
+
+	m, err := NewMigrator(nil, []Migration{{Version: 2, Up: "SELECT 2"}, {Version: 1, Up: "SELECT 1"}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), m.migrations[0].Version)
+	assert.Equal(t, DefaultMigrationTable, m.table)
+}
+
+func TestMigratorDown(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	m, err := NewMigrator(db, []Migration{{Version: 1, Up: "CREATE TABLE users (id serial)", Down: "DROP TABLE users"}})
+	assert.Nil(t, err)
+
+	_, err = m.Down(ctx, -1)
+	assert.NotNil(t, err)
+	assert.Empty(t, fake.Events())
+
+	// the table is created under the lock
+	fake.Expect(`^SELECT version, applied_at FROM schema_migrations$`).
+		WillReturnRows([]string{"version", "applied_at"}, []driver.Value{int64(1), time.Now()})
+	reverted, err := m.Down(ctx, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, reverted)
+	stmts := fake.Statements()
+	assert.Len(t, stmts, 4)
+	assert.Equal(t, "SELECT pg_advisory_lock($1)", stmts[0])
+	assert.Regexp(t, `^CREATE TABLE IF NOT EXISTS schema_migrations`, stmts[1])
+	assert.Equal(t, "SELECT pg_advisory_unlock($1)", stmts[3])
+}
+
+func TestMigratorUpSingleConnection(t *testing.T) {
+	// migrations run on the connection holding the lock, rather than waiting for another one
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, fake := pqtest.New()
+	db.SetMaxOpenConns(1)
+	m, err := NewMigrator(db, []Migration{{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id serial)"}})
+	assert.Nil(t, err)
+
+	applied, err := m.Up(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+	stmts := fake.Statements()
+	assert.Equal(t, "SELECT pg_advisory_lock($1)", stmts[0])
+	assert.Equal(t, "SELECT pg_advisory_unlock($1)", stmts[len(stmts)-1])
+}
+
+func TestMigratorStatus(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	m, err := NewMigrator(db, []Migration{{Version: 1, Up: "SELECT 1"}, {Version: 2, Up: "SELECT 2"}})
+	assert.Nil(t, err)
+
+	// all pending without the table, which is not created
+	fake.Expect(`to_regclass`).WillReturnRows([]string{"exists"}, []driver.Value{false})
+	status, err := m.Status(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, status, 2)
+	assert.False(t, status[0].Applied)
+	assert.False(t, status[1].Applied)
+	assert.Equal(t, []string{"SELECT to_regclass($1) IS NOT NULL"}, fake.Statements())
+
+	fake.Reset()
+	appliedAt := time.Now()
+	fake.Expect(`to_regclass`).WillReturnRows([]string{"exists"}, []driver.Value{true})
+	fake.Expect(`^SELECT version, applied_at FROM schema_migrations$`).
+		WillReturnRows([]string{"version", "applied_at"}, []driver.Value{int64(1), appliedAt})
+	status, err = m.Status(ctx)
+	assert.Nil(t, err)
+	assert.True(t, status[0].Applied)
+	assert.Equal(t, appliedAt, status[0].AppliedAt)
+	assert.False(t, status[1].Applied)
+	assert.Len(t, fake.Statements(), 2)
+}
@@ -0,0 +1,211 @@
+package pq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// Notify ...
+func Notify(q Execer, channel string, payload interface{}) error {
+	return NotifyContext(context.Background(), q, channel, payload)
+}
+
+// NotifyContext sends `payload` marshalled into JSON to subscribers of `channel`.
+// Given a `*sql.Tx`, e.g. inside `WithTransaction`, the notification is delivered only when the transaction commits.
+func NotifyContext(ctx context.Context, q Execer, channel string, payload interface{}) (err error) {
+	bytes, err := json.Marshal(payload)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	if _, err = q.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, string(bytes)); err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// Default values of `SubscriberOption`.
+const (
+	DefaultMinReconnectInterval = time.Second
+	DefaultMaxReconnectInterval = time.Minute
+	DefaultPingInterval         = 90 * time.Second
+)
+
+// SubscriberOption ...
+type SubscriberOption struct {
+	// Interval of reconnecting after the connection is lost, which doubles until `MaxReconnectInterval` on each failed attempt.
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+
+	// Ping the server at such interval while running, whether or not notifications are received, to detect a broken connection.
+	PingInterval time.Duration
+
+	// Called after reconnected, when notifications may have been missed, e.g. to invalidate the whole cache.
+	OnReconnect func()
+}
+
+func (o SubscriberOption) withDefault() SubscriberOption {
+	if o.MinReconnectInterval <= 0 {
+		o.MinReconnectInterval = DefaultMinReconnectInterval
+	}
+	if o.MaxReconnectInterval <= 0 {
+		o.MaxReconnectInterval = DefaultMaxReconnectInterval
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = DefaultPingInterval
+	}
+	return o
+}
+
+// Subscriber listens on channels and delivers notifications to handlers, e.g.
+//    sub := NewSubscriber(conf, SubscriberOption{})
+//    defer sub.Close()
+//    sub.Handle("user_changed", func(u User) error {
+//        cache.Delete(u.ID)
+//        return nil
+//    })
+//    sub.Run(ctx)
+type Subscriber struct {
+	opt      SubscriberOption
+	listener *pq.Listener
+
+	mu       sync.RWMutex
+	handlers map[string][]reflect.Value
+
+	// set while a ping is in flight
+	pinging int32
+}
+
+// NewSubscriber connects in the background, reconnecting and listening again on all channels whenever the connection is lost.
+func NewSubscriber(conf Conf, opt SubscriberOption) *Subscriber {
+	opt = opt.withDefault()
+
+	eventCallback := func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventConnectionAttemptFailed, pq.ListenerEventDisconnected:
+			glog.Warningf("listener connection: %v", err)
+		case pq.ListenerEventReconnected:
+			glog.Infof("listener reconnected")
+		}
+	}
+
+	s := &Subscriber{
+		opt:      opt,
+		listener: pq.NewListener(conf.DSN(), opt.MinReconnectInterval, opt.MaxReconnectInterval, eventCallback),
+		handlers: make(map[string][]reflect.Value),
+	}
+	return s
+}
+
+// Handle listens on `channel` and registers `handler`, which must be a function like `func(T)` or `func(T) error`,
+// with each payload unmarshalled from JSON into a new `T`.
+func (s *Subscriber) Handle(channel string, handler interface{}) (err error) {
+	fn := reflect.ValueOf(handler)
+	if fn.Kind() != reflect.Func || fn.IsNil() || fn.Type().NumIn() != 1 || fn.Type().NumOut() > 1 ||
+		(fn.Type().NumOut() == 1 && fn.Type().Out(0) != errorType) {
+		err = fmt.Errorf("handler must be func(T) or func(T) error, got %T", handler)
+		glog.Error(err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.handlers[channel]; !ok {
+		if err = s.listener.Listen(channel); err != nil {
+			glog.Error(err)
+			return
+		}
+	}
+	s.handlers[channel] = append(s.handlers[channel], fn)
+
+	return
+}
+
+// Unhandle stops listening on `channel` and removes its handlers.
+func (s *Subscriber) Unhandle(channel string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.handlers[channel]; !ok {
+		return
+	}
+	delete(s.handlers, channel)
+	if err = s.listener.Unlisten(channel); err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// Run delivers notifications to handlers one by one until `ctx` is done.
+func (s *Subscriber) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.opt.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-s.listener.Notify:
+			if !ok {
+				return fmt.Errorf("subscriber closed")
+			}
+			if n == nil {
+				// a nil notification tells the connection was re-established
+				if s.opt.OnReconnect != nil {
+					s.opt.OnReconnect()
+				}
+				continue
+			}
+			s.dispatch(n)
+		case <-ticker.C:
+			// ping in the background, since its response may wait for notifications to be received here,
+			// and skip the tick if the last ping has not returned
+			if !atomic.CompareAndSwapInt32(&s.pinging, 0, 1) {
+				continue
+			}
+			go func() {
+				defer atomic.StoreInt32(&s.pinging, 0)
+				if err := s.listener.Ping(); err != nil {
+					glog.Warningf("listener ping: %v", err)
+				}
+			}()
+		}
+	}
+}
+
+// Close ...
+func (s *Subscriber) Close() error {
+	return s.listener.Close()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+func (s *Subscriber) dispatch(n *pq.Notification) {
+	s.mu.RLock()
+	handlers := s.handlers[n.Channel]
+	s.mu.RUnlock()
+
+	for _, fn := range handlers {
+		arg := reflect.New(fn.Type().In(0))
+		if err := json.Unmarshal([]byte(n.Extra), arg.Interface()); err != nil {
+			glog.Errorf("invalid payload on channel %s: %v", n.Channel, err)
+			continue
+		}
+
+		out := fn.Call([]reflect.Value{arg.Elem()})
+		if len(out) == 1 && !out[0].IsNil() {
+			glog.Errorf("handling notification on channel %s: %v", n.Channel, out[0].Interface())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriberDispatch(t *testing.T) {
+	type event struct {
+		ID int `json:"id"`
+	}
+
+	s := &Subscriber{handlers: make(map[string][]reflect.Value)}
+	var got []int
+	s.handlers["user_changed"] = []reflect.Value{reflect.ValueOf(func(e event) error {
+		got = append(got, e.ID)
+		return nil
+	})}
+
+	s.dispatch(&pq.Notification{Channel: "user_changed", Extra: `{"id":42}`})
+	s.dispatch(&pq.Notification{Channel: "user_changed", Extra: `not json`})
+	s.dispatch(&pq.Notification{Channel: "other", Extra: `{"id":1}`})
+	assert.Equal(t, []int{42}, got)
+}
+
+func TestSubscriberHandleInvalid(t *testing.T) {
+	type event struct{}
+
+	// invalid handlers are rejected before listening
+	s := &Subscriber{handlers: make(map[string][]reflect.Value)}
+	var nilFunc func(event)
+	for _, handler := range []interface{}{
+		nil,
+		nilFunc,
+		"not a function",
+		func() {},
+		func(a, b event) {},
+		func(e event) int { return 0 },
+		func(e event) (int, error) { return 0, nil },
+	} {
+		assert.Error(t, s.Handle("user_changed", handler), "%T", handler)
+	}
+	assert.Empty(t, s.handlers)
+}
@@ -3,7 +3,11 @@ package pq
 import (
 	"database/sql"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	// ...
 	_ "github.com/lib/pq"
@@ -16,8 +20,34 @@ type Conf struct {
 	Host     string `yaml:"host,omitempty"`
 	Port     int    `yaml:"port,omitempty"`
 	Database string `yaml:"database,omitempty"`
+
+	// One of disable, allow, prefer, require, verify-ca and verify-full. Defaults to disable.
+	SSLMode     string `yaml:"sslmode,omitempty"`
+	SSLCert     string `yaml:"sslcert,omitempty"`
+	SSLKey      string `yaml:"sslkey,omitempty"`
+	SSLRootCert string `yaml:"sslrootcert,omitempty"`
+
+	ApplicationName string `yaml:"application_name,omitempty"`
+
+	// Maximal wait for connecting, in seconds. Zero means waiting indefinitely.
+	ConnectTimeout int `yaml:"connect_timeout,omitempty"`
+
+	// Schemas to search for unqualified names, in order.
+	SearchPath []string `yaml:"search_path,omitempty"`
+
+	// Other connection parameters passed to lib/pq as is, e.g. options, target_session_attrs and fallback_application_name.
+	Params map[string]string `yaml:"params,omitempty"`
+
+	// Pool settings of `sql.DB`, which are left as default if zero.
+	MaxOpenConns    int           `yaml:"max_open_conns,omitempty"`
+	MaxIdleConns    int           `yaml:"max_idle_conns,omitempty"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime,omitempty"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time,omitempty"`
 }
 
+// DefaultSSLMode ...
+const DefaultSSLMode = "disable"
+
 // Validate ...
 func (c Conf) Validate() error {
 	if c.Username == "" {
@@ -26,28 +56,124 @@ func (c Conf) Validate() error {
 	if c.Host == "" {
 		return fmt.Errorf("missing Host")
 	}
-	if c.Port < 0 {
+	if c.Port < 0 || c.Port > 65535 {
 		return fmt.Errorf("illegal Port")
 	}
 	if c.Database == "" {
 		return fmt.Errorf("Missing Database")
 	}
+	switch c.SSLMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		// good
+	default:
+		return fmt.Errorf("invalid SSLMode: %s", c.SSLMode)
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		return fmt.Errorf("SSLCert and SSLKey must be provided together")
+	}
+	if (c.SSLCert != "" || c.SSLRootCert != "") && c.sslMode() == "disable" {
+		return fmt.Errorf("certificates are provided but SSL is disabled")
+	}
+	if c.ConnectTimeout < 0 {
+		return fmt.Errorf("illegal ConnectTimeout")
+	}
+	for _, s := range c.SearchPath {
+		if s == "" || strings.ContainsAny(s, ", ") {
+			return fmt.Errorf("invalid schema in SearchPath: %q", s)
+		}
+	}
+	if c.MaxOpenConns < 0 {
+		return fmt.Errorf("illegal MaxOpenConns")
+	}
+	if c.MaxIdleConns < 0 {
+		return fmt.Errorf("illegal MaxIdleConns")
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("MaxIdleConns exceeds MaxOpenConns")
+	}
+	if c.ConnMaxLifetime < 0 {
+		return fmt.Errorf("illegal ConnMaxLifetime")
+	}
+	if c.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("illegal ConnMaxIdleTime")
+	}
 	return nil
 }
 
+func (c Conf) sslMode() string {
+	if c.SSLMode == "" {
+		return DefaultSSLMode
+	}
+	return c.SSLMode
+}
+
+// DSN makes the connection string in URL form, with the password escaped.
+func (c Conf) DSN() string {
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   c.Host,
+		Path:   "/" + c.Database,
+	}
+	if c.Port > 0 {
+		u.Host = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	} else if strings.Contains(c.Host, ":") {
+		// an IPv6 address is bracketed as with a port
+		u.Host = "[" + c.Host + "]"
+	}
+	if c.Password != "" {
+		u.User = url.UserPassword(c.Username, c.Password)
+	} else if c.Username != "" {
+		u.User = url.User(c.Username)
+	}
+
+	q := url.Values{}
+	for key, value := range c.Params {
+		q.Set(key, value)
+	}
+	q.Set("sslmode", c.sslMode())
+	if c.SSLCert != "" {
+		q.Set("sslcert", c.SSLCert)
+	}
+	if c.SSLKey != "" {
+		q.Set("sslkey", c.SSLKey)
+	}
+	if c.SSLRootCert != "" {
+		q.Set("sslrootcert", c.SSLRootCert)
+	}
+	if c.ApplicationName != "" {
+		q.Set("application_name", c.ApplicationName)
+	}
+	if c.ConnectTimeout > 0 {
+		q.Set("connect_timeout", strconv.Itoa(c.ConnectTimeout))
+	}
+	if len(c.SearchPath) > 0 {
+		// unknown parameters are sent by lib/pq as run-time parameters
+		q.Set("search_path", strings.Join(c.SearchPath, ","))
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
 // New ...
 func New(conf Conf) (db *sql.DB, err error) {
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		conf.Username,
-		conf.Password,
-		conf.Host,
-		conf.Port,
-		conf.Database,
-	)
-	return sql.Open("postgres", connStr)
-}
+	db, err = sql.Open("postgres", conf.DSN())
+	if err != nil {
+		return
+	}
+
+	if conf.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(conf.MaxOpenConns)
+	}
+	if conf.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(conf.MaxIdleConns)
+	}
+	if conf.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+	}
+	if conf.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(conf.ConnMaxIdleTime)
+	}
 
-// IsDuplicatedKeyError ...
-func IsDuplicatedKeyError(err error, keyName string) bool {
-	return strings.Contains(err.Error(), fmt.Sprintf(`pq: duplicate key value violates unique constraint "%s"`, keyName))
+	return
 }
@@ -0,0 +1,329 @@
+// Package pqtest provides a fake `database/sql` driver to unit test code built on `db/pq` without PostgreSQL, e.g.
+//    db, fake := pqtest.New()
+//    fake.Expect(`INSERT INTO users`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)})
+//    fake.Expect(`INSERT INTO pets`).WillReturnError(&pq.Error{Code: "23503"})
+//
+//    err := CodeUnderTest(db)
+//
+//    // assert on err, fake.Events(), fake.Statements() and fake.ExpectationsWereMet()
+package pqtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// EventKind ...
+type EventKind string
+
+// Kinds of events.
+const (
+	EventPrepare  EventKind = "prepare"
+	EventExec     EventKind = "exec"
+	EventQuery    EventKind = "query"
+	EventBegin    EventKind = "begin"
+	EventCommit   EventKind = "commit"
+	EventRollback EventKind = "rollback"
+)
+
+// Event is something happened to the fake database.
+type Event struct {
+	Kind EventKind
+
+	// Only for statements.
+	SQL  string
+	Args []driver.Value
+
+	// Only for beginning transactions.
+	TxOptions driver.TxOptions
+}
+
+// Expectation scripts the result of statements whose SQL matches a pattern.
+type Expectation struct {
+	pattern *regexp.Regexp
+	always  bool
+	used    int
+
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+}
+
+// WillReturnRows makes matched queries return the rows.
+func (e *Expectation) WillReturnRows(columns []string, rows ...[]driver.Value) *Expectation {
+	e.columns = columns
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult makes matched statements affect `rowsAffected` rows.
+func (e *Expectation) WillReturnResult(rowsAffected int64) *Expectation {
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// WillReturnError makes matched statements fail, e.g. by a `*pq.Error` with some code.
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Always makes the expectation match any number of statements, rather than only the first one.
+func (e *Expectation) Always() *Expectation {
+	e.always = true
+	return e
+}
+
+// Fake is a fake database recording everything happened to it.
+// Statements matching no expectation succeed, affecting and returning no rows.
+type Fake struct {
+	mu           sync.Mutex
+	events       []Event
+	expectations []*Expectation
+	beginErr     error
+	commitErr    error
+}
+
+// New opens a database backed by a new fake, which is released together with the database.
+func New() (*sql.DB, *Fake) {
+	f := &Fake{}
+	return sql.OpenDB(connector{fake: f}), f
+}
+
+// Expect adds an expectation matching statements by `pattern`, which is a regular expression
+// matched against the SQL with consecutive whitespaces collapsed into one space.
+// Expectations are matched in the order they are added.
+func (f *Fake) Expect(pattern string) *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := &Expectation{pattern: regexp.MustCompile(pattern)}
+	f.expectations = append(f.expectations, e)
+	return e
+}
+
+// FailBegin makes beginning transactions fail.
+func (f *Fake) FailBegin(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.beginErr = err
+}
+
+// FailCommit makes committing transactions fail, after which `database/sql` does not roll back.
+func (f *Fake) FailCommit(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commitErr = err
+}
+
+// Events ...
+func (f *Fake) Events() []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Event{}, f.events...)
+}
+
+// Statements lists the SQL of executed statements and queries, with whitespaces collapsed.
+func (f *Fake) Statements() []string {
+	var stmts []string
+	for _, e := range f.Events() {
+		if e.Kind == EventExec || e.Kind == EventQuery {
+			stmts = append(stmts, e.SQL)
+		}
+	}
+	return stmts
+}
+
+// Count tells the number of events of a kind, e.g. to assert on commits.
+func (f *Fake) Count(kind EventKind) int {
+	var n int
+	for _, e := range f.Events() {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// ExpectationsWereMet tells if every expectation matched some statement.
+func (f *Fake) ExpectationsWereMet() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range f.expectations {
+		if e.used == 0 {
+			return fmt.Errorf("expectation %q is not met", e.pattern)
+		}
+	}
+	return nil
+}
+
+// Reset forgets events and expectations.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = nil
+	f.expectations = nil
+	f.beginErr = nil
+	f.commitErr = nil
+}
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func normalize(query string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(query, " "))
+}
+
+func (f *Fake) record(e Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, e)
+}
+
+// match records a statement and finds its expectation.
+func (f *Fake) match(kind EventKind, query string, args []driver.Value) *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.events = append(f.events, Event{Kind: kind, SQL: query, Args: args})
+	for _, e := range f.expectations {
+		if (e.always || e.used == 0) && e.pattern.MatchString(query) {
+			e.used++
+			return e
+		}
+	}
+	return &Expectation{}
+}
+
+// connector connects to a fake directly, thus no driver needs to be registered by name.
+type connector struct {
+	fake *Fake
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{fake: c.fake}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{fake: c.fake}
+}
+
+type fakeDriver struct {
+	fake *Fake
+}
+
+func (d fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{fake: d.fake}, nil
+}
+
+type fakeConn struct {
+	fake *Fake
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	query = normalize(query)
+	c.fake.record(Event{Kind: EventPrepare, SQL: query})
+	return &fakeStmt{fake: c.fake, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.fake.mu.Lock()
+	err := c.fake.beginErr
+	c.fake.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	c.fake.record(Event{Kind: EventBegin, TxOptions: opts})
+	return &fakeTx{fake: c.fake}, nil
+}
+
+type fakeTx struct {
+	fake *Fake
+}
+
+func (t *fakeTx) Commit() error {
+	t.fake.mu.Lock()
+	err := t.fake.commitErr
+	t.fake.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	t.fake.record(Event{Kind: EventCommit})
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.fake.record(Event{Kind: EventRollback})
+	return nil
+}
+
+type fakeStmt struct {
+	fake  *Fake
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	// do not let `database/sql` check the number of arguments
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	e := s.fake.match(EventExec, s.query, args)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return driver.RowsAffected(e.rowsAffected), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	e := s.fake.match(EventQuery, s.query, args)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return &fakeRows{columns: e.columns, rows: e.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
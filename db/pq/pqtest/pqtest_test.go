@@ -0,0 +1,83 @@
+package pqtest_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq"
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	libpq "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name string `db:"name"`
+	Age  int    `db:"age"`
+}
+
+func TestBatchInsert(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^INSERT INTO users \(name,age\) VALUES`).
+		WillReturnRows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+
+	ids, err := pq.BatchInsert(db, "users", []pq.Record{
+		user{Name: "Tom", Age: 3},
+		user{Name: "Jerry", Age: 4},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.Nil(t, fake.ExpectationsWereMet())
+
+	assert.Equal(t, []string{"INSERT INTO users (name,age) VALUES ($1,$2),($3,$4) RETURNING id"}, fake.Statements())
+	assert.Equal(t, 1, fake.Count(pqtest.EventBegin))
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+	assert.Equal(t, 0, fake.Count(pqtest.EventRollback))
+}
+
+func TestWithTransactionRollback(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`INSERT INTO pets`).WillReturnError(&libpq.Error{Code: "23503", Constraint: "pets_owner_id_fkey"})
+
+	err := pq.WithTransaction(db, func(tx *sql.Tx) (bool, error) {
+		if _, err := tx.Exec(`UPDATE users SET age = age + 1`); err != nil {
+			return false, err
+		}
+		_, err := tx.Exec(`INSERT INTO pets (owner_id) VALUES ($1)`, 42)
+		return false, err
+	})
+	assert.True(t, pq.IsForeignKeyViolation(err))
+	assert.Equal(t, "pets_owner_id_fkey", pq.ClassifyError(err).Constraint)
+	assert.Equal(t, 0, fake.Count(pqtest.EventCommit))
+	assert.Equal(t, 1, fake.Count(pqtest.EventRollback))
+
+	events := fake.Events()
+	assert.Equal(t, pqtest.EventExec, events[len(events)-2].Kind)
+	assert.Equal(t, []driver.Value{int64(42)}, events[len(events)-2].Args)
+}
+
+func TestWithTransactionRetry(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`UPDATE accounts`).WillReturnError(&libpq.Error{Code: "40001"})
+
+	attempts, err := pq.WithTransactionRetry(db, pq.RetryOption{BaseBackoff: time.Millisecond}, func(tx *sql.Tx) (bool, error) {
+		_, err := tx.Exec(`UPDATE accounts SET balance = balance - 1`)
+		return false, err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+}
+
+func TestFailCommit(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.FailCommit(fmt.Errorf("connection lost"))
+
+	err := pq.WithTransaction(db, func(tx *sql.Tx) (bool, error) {
+		return false, nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, fake.Count(pqtest.EventCommit))
+}
@@ -0,0 +1,336 @@
+package pq
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// queryArgs collects arguments while a query is built, numbering their placeholders.
+type queryArgs struct {
+	args []interface{}
+}
+
+func (a *queryArgs) add(v interface{}) string {
+	a.args = append(a.args, v)
+	return fmt.Sprintf("$%d", len(a.args))
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`^\$(\d+)`)
+	dollarQuotePattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+)
+
+// addRaw appends arguments of a SQL fragment whose placeholders are numbered from $1, and renumbers them to follow the existing ones.
+// Quoted strings, quoted identifiers and dollar-quoted bodies are kept as is.
+func (a *queryArgs) addRaw(sql string, args []interface{}) string {
+	offset := len(a.args)
+	a.args = append(a.args, args...)
+	if offset == 0 {
+		return sql
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(sql); {
+		j := i + 1
+		switch c := sql[i]; c {
+		case '\'', '"':
+			// backslashes escape only in strings like E'...'
+			escapable := c == '\'' && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e')
+			j = skipQuoted(sql, i, escapable)
+		case '$':
+			if m := placeholderPattern.FindStringSubmatch(sql[i:]); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				fmt.Fprintf(&b, "$%d", n+offset)
+				i += len(m[0])
+				continue
+			}
+			if tag := dollarQuotePattern.FindString(sql[i:]); tag != "" {
+				j = len(sql)
+				if k := strings.Index(sql[i+len(tag):], tag); k >= 0 {
+					j = i + len(tag) + k + len(tag)
+				}
+			}
+		}
+		b.WriteString(sql[i:j])
+		i = j
+	}
+	return b.String()
+}
+
+// skipQuoted returns the end of the quoted text starting at `i`, where a doubled quote is escaped.
+func skipQuoted(sql string, i int, escapable bool) int {
+	q := sql[i]
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case escapable && sql[j] == '\\':
+			j++
+		case sql[j] == q:
+			if j+1 < len(sql) && sql[j+1] == q {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+// Cond is a condition in `WHERE`, whose placeholders are numbered when the query is built.
+type Cond interface {
+	build(a *queryArgs) string
+}
+
+type condFunc func(a *queryArgs) string
+
+func (f condFunc) build(a *queryArgs) string {
+	return f(a)
+}
+
+func compare(column string, op string, value interface{}) Cond {
+	return condFunc(func(a *queryArgs) string {
+		return fmt.Sprintf("%s %s %s", column, op, a.add(value))
+	})
+}
+
+// Eq ...
+func Eq(column string, value interface{}) Cond {
+	return compare(column, "=", value)
+}
+
+// Ne ...
+func Ne(column string, value interface{}) Cond {
+	return compare(column, "<>", value)
+}
+
+// Lt ...
+func Lt(column string, value interface{}) Cond {
+	return compare(column, "<", value)
+}
+
+// Le ...
+func Le(column string, value interface{}) Cond {
+	return compare(column, "<=", value)
+}
+
+// Gt ...
+func Gt(column string, value interface{}) Cond {
+	return compare(column, ">", value)
+}
+
+// Ge ...
+func Ge(column string, value interface{}) Cond {
+	return compare(column, ">=", value)
+}
+
+// Like ...
+func Like(column string, pattern string) Cond {
+	return compare(column, "LIKE", pattern)
+}
+
+// In tells if the column is in `values`, which must be a slice and is passed as a single array argument, i.e.
+//    column = ANY($1)
+func In(column string, values interface{}) Cond {
+	return condFunc(func(a *queryArgs) string {
+		return fmt.Sprintf("%s = ANY(%s)", column, a.add(pq.Array(values)))
+	})
+}
+
+// NotIn is the opposite of `In`.
+func NotIn(column string, values interface{}) Cond {
+	return condFunc(func(a *queryArgs) string {
+		return fmt.Sprintf("%s <> ALL(%s)", column, a.add(pq.Array(values)))
+	})
+}
+
+// IsNull ...
+func IsNull(column string) Cond {
+	return Raw(column + " IS NULL")
+}
+
+// IsNotNull ...
+func IsNotNull(column string) Cond {
+	return Raw(column + " IS NOT NULL")
+}
+
+// Raw makes a condition from a SQL fragment with placeholders numbered from $1, e.g.
+//    Raw("lower(email) = $1", email)
+// where `$n` in quoted strings and dollar-quoted bodies is not taken as a placeholder.
+func Raw(sql string, args ...interface{}) Cond {
+	return condFunc(func(a *queryArgs) string {
+		return a.addRaw(sql, args)
+	})
+}
+
+func join(op string, conds []Cond) Cond {
+	return condFunc(func(a *queryArgs) string {
+		var parts []string
+		for _, c := range conds {
+			parts = append(parts, "("+c.build(a)+")")
+		}
+		if len(parts) == 0 {
+			// neutral element of AND and OR respectively
+			if op == " AND " {
+				return "TRUE"
+			}
+			return "FALSE"
+		}
+		return strings.Join(parts, op)
+	})
+}
+
+// And ...
+func And(conds ...Cond) Cond {
+	return join(" AND ", conds)
+}
+
+// Or ...
+func Or(conds ...Cond) Cond {
+	return join(" OR ", conds)
+}
+
+// Not ...
+func Not(cond Cond) Cond {
+	return condFunc(func(a *queryArgs) string {
+		return "NOT (" + cond.build(a) + ")"
+	})
+}
+
+// After is the keyset pagination condition telling if rows come after the last one of the previous page, e.g.
+//    After([]string{"created_at", "id"}, lastCreatedAt, lastID)
+// results in
+//    (created_at, id) > ($1, $2)
+// which should be used together with `OrderBy("created_at", "id")`.
+// It panics if the numbers of columns and values differ.
+func After(columns []string, values ...interface{}) Cond {
+	return keyset(columns, ">", values)
+}
+
+// Before is `After` for descending order.
+func Before(columns []string, values ...interface{}) Cond {
+	return keyset(columns, "<", values)
+}
+
+func keyset(columns []string, op string, values []interface{}) Cond {
+	if len(columns) != len(values) {
+		panic(fmt.Sprintf("keyset of %d columns with %d values", len(columns), len(values)))
+	}
+	return condFunc(func(a *queryArgs) string {
+		var phds []string
+		for _, v := range values {
+			phds = append(phds, a.add(v))
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ","), op, strings.Join(phds, ","))
+	})
+}
+
+// SelectBuilder composes a `SELECT` statement, e.g.
+//    query, args := NewSelect("users AS u", "u.id", "u.name").
+//        Join("JOIN orders AS o ON o.user_id = u.id").
+//        Where(Eq("u.country", "China"), Or(Gt("o.amount", 100), In("o.status", []string{"paid", "shipped"}))).
+//        OrderBy("u.id").
+//        Limit(20).
+//        Build()
+// where `args` can be passed to `Exec.SetArgs` or `Select`.
+type SelectBuilder struct {
+	table   TableName
+	columns []string
+	joins   []Cond
+	where   []Cond
+	orders  []string
+	limit   int
+	offset  int
+
+	withDeleted bool
+}
+
+// NewSelect selects all columns if `columns` is empty.
+func NewSelect(table TableName, columns ...string) *SelectBuilder {
+	b := &SelectBuilder{
+		table:   table,
+		columns: columns,
+	}
+	return b
+}
+
+// Columns ...
+func (b *SelectBuilder) Columns(columns ...string) *SelectBuilder {
+	b.columns = columns
+	return b
+}
+
+// Join adds a join clause, whose placeholders are numbered from $1, e.g.
+//    Join("LEFT JOIN orders AS o ON o.user_id = u.id AND o.status = $1", "paid")
+func (b *SelectBuilder) Join(clause string, args ...interface{}) *SelectBuilder {
+	b.joins = append(b.joins, Raw(clause, args...))
+	return b
+}
+
+// Where adds conditions, which are ANDed with existing ones.
+func (b *SelectBuilder) Where(conds ...Cond) *SelectBuilder {
+	b.where = append(b.where, conds...)
+	return b
+}
+
+// OrderBy adds ordering expressions, e.g. "created_at DESC".
+func (b *SelectBuilder) OrderBy(exprs ...string) *SelectBuilder {
+	b.orders = append(b.orders, exprs...)
+	return b
+}
+
+// Limit is ignored if not positive.
+func (b *SelectBuilder) Limit(n int) *SelectBuilder {
+	b.limit = n
+	return b
+}
+
+// Offset is ignored if not positive.
+func (b *SelectBuilder) Offset(n int) *SelectBuilder {
+	b.offset = n
+	return b
+}
+
+// WithDeleted also selects rows soft deleted under `Conventions.DeletedAt`, which are skipped by default.
+// Note that only a table named exactly as registered, i.e. without alias or join, is recognized.
+func (b *SelectBuilder) WithDeleted() *SelectBuilder {
+	b.withDeleted = true
+	return b
+}
+
+// Build ...
+func (b *SelectBuilder) Build() (query string, args []interface{}) {
+	var a queryArgs
+
+	columns := "*"
+	if len(b.columns) > 0 {
+		columns = strings.Join(b.columns, ",")
+	}
+	parts := []string{fmt.Sprintf("SELECT %s FROM %s", columns, b.table)}
+
+	for _, j := range b.joins {
+		parts = append(parts, j.build(&a))
+	}
+	where := b.where
+	if c := conventionsOf(b.table); c != nil && c.DeletedAt != "" && !b.withDeleted {
+		where = append(append([]Cond{}, where...), IsNull(fmt.Sprintf("%s.%s", b.table, c.DeletedAt)))
+	}
+	if len(where) > 0 {
+		parts = append(parts, "WHERE "+And(where...).build(&a))
+	}
+	if len(b.orders) > 0 {
+		parts = append(parts, "ORDER BY "+strings.Join(b.orders, ","))
+	}
+	if b.limit > 0 {
+		parts = append(parts, "LIMIT "+a.add(b.limit))
+	}
+	if b.offset > 0 {
+		parts = append(parts, "OFFSET "+a.add(b.offset))
+	}
+
+	query = strings.Join(parts, " ")
+	args = a.args
+	return
+}
@@ -0,0 +1,60 @@
+package pq
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectBuilder(t *testing.T) {
+	statuses := []string{"paid", "shipped"}
+	query, args := NewSelect("users AS u", "u.id", "u.name").
+		Join("JOIN orders AS o ON o.user_id = u.id AND o.deleted = $1", false).
+		Where(Eq("u.country", "China"), Or(Gt("o.amount", 100), In("o.status", statuses))).
+		Where(Raw("lower(u.email) LIKE $1 OR lower(u.name) LIKE $1", "%tom%")).
+		OrderBy("u.id").
+		Limit(20).
+		Offset(40).
+		Build()
+
+	assert.Equal(t, "SELECT u.id,u.name FROM users AS u "+
+		"JOIN orders AS o ON o.user_id = u.id AND o.deleted = $1 "+
+		"WHERE (u.country = $2) AND ((o.amount > $3) OR (o.status = ANY($4))) AND (lower(u.email) LIKE $5 OR lower(u.name) LIKE $5) "+
+		"ORDER BY u.id LIMIT $6 OFFSET $7", query)
+	assert.Equal(t, []interface{}{false, "China", 100, pq.Array(statuses), "%tom%", 20, 40}, args)
+}
+
+func TestKeysetPagination(t *testing.T) {
+	query, args := NewSelect("events").
+		Where(IsNull("deleted_at"), Before([]string{"created_at", "id"}, "2021-01-01", 42)).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(10).
+		Build()
+
+	assert.Equal(t, "SELECT * FROM events WHERE (deleted_at IS NULL) AND ((created_at,id) < ($1,$2)) ORDER BY created_at DESC,id DESC LIMIT $3", query)
+	assert.Equal(t, []interface{}{"2021-01-01", 42, 10}, args)
+}
+
+func TestEmptyConds(t *testing.T) {
+	query, args := NewSelect("users").Where(Or(), Not(And())).Build()
+	assert.Equal(t, "SELECT * FROM users WHERE (FALSE) AND (NOT (TRUE))", query)
+	assert.Empty(t, args)
+}
+
+func TestRawQuoted(t *testing.T) {
+	// only placeholders out of quoted text are renumbered
+	query, args := NewSelect("notes").
+		Where(Eq("user_id", 1)).
+		Where(Raw(`body <> 'costs $1' AND "col$1" = $1 AND tag <> E'it\'s $1' AND fn <> $f$ $1 $f$ AND memo <> $$it's $1$$ OR id = $2`, "a", 2)).
+		Build()
+	assert.Equal(t, `SELECT * FROM notes WHERE (user_id = $1) AND `+
+		`(body <> 'costs $1' AND "col$1" = $2 AND tag <> E'it\'s $1' AND fn <> $f$ $1 $f$ AND memo <> $$it's $1$$ OR id = $3)`, query)
+	assert.Equal(t, []interface{}{1, "a", 2}, args)
+}
+
+func TestKeysetMismatch(t *testing.T) {
+	assert.Panics(t, func() {
+		After([]string{"created_at", "id"}, 42)
+	})
+}
@@ -1,7 +1,12 @@
 package pq
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"reflect"
+	"strings"
+	"time"
 )
 
 // Record ...
@@ -17,6 +22,15 @@ type Record interface{}
 //    }
 // will result in a map
 //    name -> XXX, gender -> XXX
+//
+// Options can follow the column name in the `db` tag, e.g.
+// 	  struct Record {
+// 	 	Age int `db:"age,keepempty"` // empty value will be kept
+// 		CreatedAt time.Time `db:"created_at,readonly"` // will be ignored, e.g. filled by database
+// 		Data map[string]int `db:"data,json"` // will be marshalled into JSON, e.g. for a `jsonb` column
+// 		Skipped string `db:"-"` // will be ignored
+// 		Embedded // fields of embedded struct without `db` tag will be flattened
+//    }
 func MapColumn(r Record) map[string]interface{} {
 	var opt MapColumnOption
 	return MapColumnWithOption(r, opt)
@@ -30,7 +44,11 @@ type MapColumnOption struct {
 
 	// Columns whose value is empty should also be inserted instead of omitted.
 	// For example, for an NOT-NULL integer column whose being 0 is perfect valid, we should add it to this option.
+	// Prefer the `keepempty` tag option, which is equivalent.
 	KeepEmptyValueColums []string
+
+	// Table to insert the record into, whose conventional columns are filled if registered by `RegisterConventions`.
+	Table TableName
 }
 
 // MapColumnWithOption ...
@@ -47,25 +65,30 @@ func MapColumnWithOption(r Record, opt MapColumnOption) map[string]interface{} {
 		val = val.Elem()
 	}
 
-	typ := val.Type()
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
+	for _, field := range structColumns(val.Type()) {
+		if field.readOnly {
+			continue
+		}
+		dbColumn := field.column
 
-		dbColumn := field.Tag.Get("db")
-		if dbColumn == "" {
-			// ignore field without `db` tag
+		value, ok := fieldByIndex(val, field.index)
+		if !ok {
+			// fields of a nil embedded pointer
 			continue
 		}
+		keepEmpty := field.keepEmpty || keepEmptyValueCol[dbColumn]
 
-		value := val.FieldByName(field.Name)
-		if !value.CanInterface() {
-			// ignore private fields
+		if field.json {
+			if isEmptyValue(value) && !keepEmpty {
+				continue
+			}
+			table[dbColumn] = jsonValue{value.Interface()}
 			continue
 		}
 
 		// can not use `reflect.Zero(field.Type).Interface() == value.Interface()` to tell if a slice is empty, thus we check by cases
 		if value.Kind() == reflect.Slice {
-			if value.Len() == 0 && !keepEmptyValueCol[dbColumn] {
+			if value.Len() == 0 && !keepEmpty {
 				// empty slice
 				continue
 			}
@@ -76,7 +99,7 @@ func MapColumnWithOption(r Record, opt MapColumnOption) map[string]interface{} {
 				continue
 			}
 		} else {
-			if reflect.Zero(field.Type).Interface() == value.Interface() && !keepEmptyValueCol[dbColumn] {
+			if isEmptyValue(value) && !keepEmpty {
 				// ignore fields with empty value
 				continue
 			}
@@ -84,5 +107,218 @@ func MapColumnWithOption(r Record, opt MapColumnOption) map[string]interface{} {
 		}
 	}
 
+	if c := conventionsOf(opt.Table); c != nil {
+		c.fillInsert(table, time.Now())
+	}
+
 	return table
 }
+
+// columnValue gets the value of a column from a record regardless of tag options, e.g. read-only keys.
+func columnValue(r Record, column string) (value interface{}, ok bool) {
+	val := reflect.ValueOf(r)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	for _, field := range structColumns(val.Type()) {
+		if field.column != column {
+			continue
+		}
+		v, found := fieldByIndex(val, field.index)
+		if !found {
+			return
+		}
+		return v.Interface(), true
+	}
+	return
+}
+
+// columnField is a struct field mapped to a column by its `db` tag.
+type columnField struct {
+	column string
+	index  []int
+	typ    reflect.Type
+
+	// tag options
+	keepEmpty bool
+	readOnly  bool
+	json      bool
+}
+
+// parseTag parses a `db` tag like `db:"data,json,keepempty"`.
+// Unknown options are ignored, e.g. `omitempty` of tags shared with other libraries.
+func parseTag(tag string) (column string, keepEmpty bool, readOnly bool, isJSON bool) {
+	parts := strings.Split(tag, ",")
+	column = strings.TrimSpace(parts[0])
+	for _, opt := range parts[1:] {
+		switch strings.TrimSpace(opt) {
+		case "keepempty":
+			keepEmpty = true
+		case "readonly":
+			readOnly = true
+		case "json":
+			isJSON = true
+		}
+	}
+	return
+}
+
+// structColumns lists the public fields of a struct type mapped to columns, in the order of fields.
+// Embedded structs without `db` tag are flattened, whose columns are shadowed by those of the outer struct.
+func structColumns(typ reflect.Type) (fields []columnField) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	type item struct {
+		field    columnField
+		embedded []columnField
+	}
+	var items []item
+	defined := make(map[string]bool)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag, hasTag := field.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && !hasTag {
+			embeddedType := field.Type
+			if embeddedType.Kind() == reflect.Ptr {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() != reflect.Struct {
+				continue
+			}
+			if field.PkgPath != "" && field.Type.Kind() == reflect.Ptr {
+				// ignore private embedded pointers, which can not be allocated through reflection
+				continue
+			}
+			var embedded []columnField
+			for _, f := range structColumns(embeddedType) {
+				f.index = append([]int{i}, f.index...)
+				embedded = append(embedded, f)
+			}
+			items = append(items, item{embedded: embedded})
+			continue
+		}
+
+		if tag == "" {
+			// ignore field without `db` tag
+			continue
+		}
+		if field.PkgPath != "" {
+			// ignore private fields
+			continue
+		}
+
+		column, keepEmpty, readOnly, isJSON := parseTag(tag)
+		if column == "" {
+			continue
+		}
+		defined[column] = true
+		items = append(items, item{field: columnField{
+			column:    column,
+			index:     field.Index,
+			typ:       field.Type,
+			keepEmpty: keepEmpty,
+			readOnly:  readOnly,
+			json:      isJSON,
+		}})
+	}
+
+	for _, it := range items {
+		if it.embedded == nil {
+			fields = append(fields, it.field)
+			continue
+		}
+		for _, f := range it.embedded {
+			if defined[f.column] {
+				continue
+			}
+			defined[f.column] = true
+			fields = append(fields, f)
+		}
+	}
+
+	return
+}
+
+// fieldByIndex is `reflect.Value.FieldByIndex` which tells instead of panicking if there is a nil embedded pointer on the way.
+func fieldByIndex(val reflect.Value, index []int) (field reflect.Value, ok bool) {
+	field = val
+	for i, x := range index {
+		if i > 0 && field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return
+			}
+			field = field.Elem()
+		}
+		field = field.Field(x)
+	}
+	ok = true
+	return
+}
+
+// fieldByIndexAlloc is `reflect.Value.FieldByIndex` which allocates nil embedded pointers on the way.
+func fieldByIndexAlloc(val reflect.Value, index []int) reflect.Value {
+	field := val
+	for i, x := range index {
+		if i > 0 && field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		field = field.Field(x)
+	}
+	return field
+}
+
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	}
+	if !value.Type().Comparable() {
+		return false
+	}
+	return reflect.Zero(value.Type()).Interface() == value.Interface()
+}
+
+// jsonValue marshals a field with the `json` tag option into JSON.
+type jsonValue struct {
+	v interface{}
+}
+
+// Value implements `driver.Valuer`.
+func (j jsonValue) Value() (driver.Value, error) {
+	bytes, err := json.Marshal(j.v)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// jsonScanner unmarshals JSON into a field with the `json` tag option, leaving it untouched for NULL.
+type jsonScanner struct {
+	ptr interface{}
+}
+
+// Scan implements `sql.Scanner`.
+func (j jsonScanner) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(s, j.ptr)
+	case string:
+		return json.Unmarshal([]byte(s), j.ptr)
+	}
+	return fmt.Errorf("can not unmarshal %T as JSON", src)
+}
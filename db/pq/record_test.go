@@ -1,7 +1,10 @@
 package pq
 
 import (
+	"database/sql/driver"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -41,3 +44,61 @@ func TestDBMapColumn(t *testing.T) {
 	assert.Equal(t, table["is_male"], &isMale)
 	assert.Equal(t, table["avg"], 0)
 }
+
+type embeddedRecord struct {
+	Country string `db:"country"`
+	Name    string `db:"embedded_name"`
+	Age     int    `db:"age"`
+}
+
+type taggedRecord struct {
+	ID        int            `db:"id,readonly"`
+	Name      string         `db:"name"`
+	Age       int            `db:"age,keepempty"`
+	Data      map[string]int `db:"data,json"`
+	Skipped   string         `db:"-"`
+	CreatedAt *time.Time     `db:"created_at,readonly"`
+	embeddedRecord
+}
+
+func TestDBMapColumnTagOptions(t *testing.T) {
+	r := taggedRecord{
+		ID:      1,                      // read-only field should be ignored
+		Name:    "Tom",                  // shoud be mapped
+		Age:     0,                      // kept empty value
+		Data:    map[string]int{"a": 1}, // marshalled as JSON
+		Skipped: "skipped",              // field tagged `-` should be ignored
+	}
+
+	table := MapColumn(r)
+	assert.Equal(t, 3, len(table))
+	assert.Equal(t, "Tom", table["name"])
+	assert.Equal(t, 0, table["age"])
+	data, err := table["data"].(driver.Valuer).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"a":1}`, data)
+
+	// embedded fields are flattened, and shadowed by outer ones
+	r.embeddedRecord = embeddedRecord{Country: "China", Name: "Jerry", Age: 3}
+	table = MapColumn(&r)
+	assert.Equal(t, 5, len(table))
+	assert.Equal(t, "China", table["country"])
+	assert.Equal(t, "Jerry", table["embedded_name"])
+	assert.Equal(t, 0, table["age"])
+}
+
+func TestStructColumns(t *testing.T) {
+	var columns []string
+	for _, f := range structColumns(reflect.TypeOf(taggedRecord{})) {
+		columns = append(columns, f.column)
+	}
+	assert.Equal(t, []string{"id", "name", "age", "data", "created_at", "country", "embedded_name"}, columns)
+
+	// unknown options are ignored
+	fields := structColumns(reflect.TypeOf(struct {
+		Name string `db:"name,omitempty,keepempty"`
+	}{}))
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "name", fields[0].column)
+	assert.True(t, fields[0].keepEmpty)
+}
@@ -0,0 +1,220 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/golang/glog"
+)
+
+// ExecQueryer is implemented by both `*sql.DB` and `*sql.Tx`.
+type ExecQueryer interface {
+	Execer
+	QueryerContext
+}
+
+// RepositoryOption ...
+type RepositoryOption struct {
+	// Column identifying rows, which is "id" if empty.
+	Key ColumnName
+
+	// Used by `Create` and `CreateMany`, which return the key column instead of `Returning`.
+	Insert InsertOption
+
+	// Columns whose value is empty should also be updated by `Update`, instead of omitted.
+	KeepEmptyValueColums []ColumnName
+}
+
+// Repository accesses rows of a table as records of a struct type, driven by `db` tags, e.g.
+//    users, err := NewRepository("users", User{}, RepositoryOption{})
+//    var id int
+//    err = users.Create(ctx, db, &User{Name: "Tom"}, &id)
+//
+//    var u User
+//    err = users.Get(ctx, db, id, &u)
+//
+//    var page []User
+//    err = users.List(ctx, db, &page, ListOption{Where: []Cond{Gt("age", 18)}, OrderBy: []string{"id"}, Limit: 20})
+// Every method works on either a `*sql.DB`, or a `*sql.Tx` e.g. inside `WithTransaction`,
+// and follows conventions of the table if registered by `RegisterConventions`.
+type Repository struct {
+	table   TableName
+	typ     reflect.Type
+	key     ColumnName
+	columns []string
+	opt     RepositoryOption
+}
+
+// ListOption ...
+type ListOption struct {
+	Where   []Cond
+	OrderBy []string
+
+	// Ignored if not positive.
+	Limit  int
+	Offset int
+}
+
+// NewRepository makes a repository of records of the type of `prototype`, which must be a struct or a pointer to struct.
+// An error is returned if the type is invalid or has no key column.
+func NewRepository(table TableName, prototype Record, opt RepositoryOption) (*Repository, error) {
+	typ := reflect.TypeOf(prototype)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("repository prototype must be a struct, got %T", prototype)
+	}
+
+	if opt.Key == "" {
+		opt.Key = "id"
+	}
+
+	r := &Repository{
+		table: table,
+		typ:   typ,
+		key:   opt.Key,
+		opt:   opt,
+	}
+
+	var hasKey bool
+	for _, f := range structColumns(typ) {
+		r.columns = append(r.columns, f.column)
+		if f.column == string(opt.Key) {
+			hasKey = true
+		}
+	}
+	if !hasKey {
+		return nil, fmt.Errorf("missing key column %s in %v", opt.Key, typ)
+	}
+
+	return r, nil
+}
+
+// Table ...
+func (r *Repository) Table() TableName {
+	return r.table
+}
+
+// Create inserts a record and scans its key into `key`, e.g. a `*int` or a `*string` for UUIDs, which can be nil if not needed.
+// `key` is left untouched if the record is not inserted, e.g. by `ON CONFLICT DO NOTHING`.
+func (r *Repository) Create(ctx context.Context, q ExecQueryer, record Record, key interface{}) (err error) {
+	if key == nil {
+		return r.CreateMany(ctx, q, []Record{record}, nil)
+	}
+	val := reflect.ValueOf(key)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		err = fmt.Errorf("key must be a non-nil pointer, got %T", key)
+		glog.Error(err)
+		return
+	}
+
+	keys := reflect.New(reflect.SliceOf(val.Type().Elem()))
+	if err = r.CreateMany(ctx, q, []Record{record}, keys.Interface()); err != nil {
+		return
+	}
+	if keys.Elem().Len() > 0 {
+		val.Elem().Set(keys.Elem().Index(0))
+	}
+	return
+}
+
+// CreateMany inserts records as `BatchInsertReturning` does, or `BatchInsertReturningTransaction` given a `*sql.Tx`,
+// and appends keys of inserted rows to `keys`, e.g. a `*[]int`, which can be nil if not needed.
+func (r *Repository) CreateMany(ctx context.Context, q ExecQueryer, records []Record, keys interface{}) (err error) {
+	opt := r.opt.Insert
+	if keys == nil {
+		opt.NoID = true
+		opt.Returning = nil
+		switch h := q.(type) {
+		case *sql.DB:
+			_, err = BatchInsertWithOptionContext(ctx, h, r.table, records, opt)
+		case *sql.Tx:
+			_, err = BatchInsertTransactionContext(ctx, h, r.table, records, opt)
+		default:
+			err = fmt.Errorf("creating records requires *sql.DB or *sql.Tx, got %T", q)
+			glog.Error(err)
+		}
+		return
+	}
+
+	opt.Returning = []ColumnName{r.key}
+	switch h := q.(type) {
+	case *sql.DB:
+		return BatchInsertReturningContext(ctx, h, r.table, records, opt, keys)
+	case *sql.Tx:
+		return BatchInsertReturningTransactionContext(ctx, h, r.table, records, opt, keys)
+	default:
+		err = fmt.Errorf("creating records requires *sql.DB or *sql.Tx, got %T", q)
+		glog.Error(err)
+		return
+	}
+}
+
+// Get scans the row whose key is `key` into `dest`, which must be a pointer to struct,
+// and returns `sql.ErrNoRows` if there is no such row.
+func (r *Repository) Get(ctx context.Context, q ExecQueryer, key interface{}, dest interface{}) (err error) {
+	query, args := NewSelect(r.table, r.columns...).
+		Where(Eq(string(r.key), key)).
+		Limit(1).
+		Build()
+	return SelectContext(ctx, q, dest, query, args...)
+}
+
+// List appends rows to `dest` as `Select` does, which must be a pointer to a slice.
+func (r *Repository) List(ctx context.Context, q ExecQueryer, dest interface{}, opt ListOption) (err error) {
+	query, args := NewSelect(r.table, r.columns...).
+		Where(opt.Where...).
+		OrderBy(opt.OrderBy...).
+		Limit(opt.Limit).
+		Offset(opt.Offset).
+		Build()
+	return SelectContext(ctx, q, dest, query, args...)
+}
+
+// Count tells the number of rows satisfying all `conds`.
+func (r *Repository) Count(ctx context.Context, q ExecQueryer, conds ...Cond) (count int64, err error) {
+	query, args := NewSelect(r.table, "count(*)").
+		Where(conds...).
+		Build()
+
+	var counts []int64
+	if err = SelectContext(ctx, q, &counts, query, args...); err != nil {
+		return
+	}
+	if len(counts) != 1 {
+		err = fmt.Errorf("%d rows are counted", len(counts))
+		glog.Error(err)
+		return
+	}
+	count = counts[0]
+	return
+}
+
+// Update updates the row identified by the key of `record` as `Update` does,
+// which fails with a `*ConflictError` if the version of `record` is stale under `Conventions.Version`.
+func (r *Repository) Update(ctx context.Context, q ExecQueryer, record Record) (affected int64, err error) {
+	opt := UpdateOption{
+		KeyColumns:           []ColumnName{r.key},
+		KeepEmptyValueColums: r.opt.KeepEmptyValueColums,
+	}
+	return UpdateContext(ctx, q, r.table, record, opt)
+}
+
+// Delete deletes the row whose key is `key`, or soft deletes it under `Conventions.DeletedAt`.
+func (r *Repository) Delete(ctx context.Context, q ExecQueryer, key interface{}) (affected int64, err error) {
+	query, args := makeDeleteQuery(r.table, fmt.Sprintf(`%s = $1`, r.key), []interface{}{key})
+	res, err := execObserved(ctx, q, query, args)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return res.RowsAffected()
+}
+
+// DeleteMany deletes rows whose key is in `keys`, which must be a slice, as `BatchDelete` does.
+func (r *Repository) DeleteMany(ctx context.Context, q ExecQueryer, keys interface{}) (affected int64, err error) {
+	return BatchDeleteContext(ctx, q, r.table, r.key, keys)
+}
@@ -0,0 +1,111 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type repoUser struct {
+	ID   int    `db:"id,readonly"`
+	Name string `db:"name"`
+	Age  int    `db:"age"`
+}
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	users, err := NewRepository("users", repoUser{}, RepositoryOption{})
+	assert.NoError(t, err)
+
+	fake.Expect(`^INSERT INTO users`).WillReturnRows([]string{"id"}, []driver.Value{int64(7)})
+	var id int
+	err = users.Create(ctx, db, &repoUser{Name: "Tom", Age: 18}, &id)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, id)
+
+	fake.Expect(`^SELECT id,name,age FROM users WHERE \(id = \$1\) LIMIT \$2$`).
+		WillReturnRows([]string{"id", "name", "age"}, []driver.Value{int64(7), "Tom", int64(18)})
+	var u repoUser
+	assert.NoError(t, users.Get(ctx, db, 7, &u))
+	assert.Equal(t, repoUser{ID: 7, Name: "Tom", Age: 18}, u)
+
+	assert.Equal(t, sql.ErrNoRows, users.Get(ctx, db, 8, &u))
+
+	fake.Expect(`^SELECT id,name,age FROM users WHERE \(age > \$1\) ORDER BY id LIMIT \$2 OFFSET \$3$`).
+		WillReturnRows([]string{"id", "name", "age"}, []driver.Value{int64(7), "Tom", int64(18)}, []driver.Value{int64(9), "Amy", int64(20)})
+	var page []repoUser
+	assert.NoError(t, users.List(ctx, db, &page, ListOption{Where: []Cond{Gt("age", 17)}, OrderBy: []string{"id"}, Limit: 2, Offset: 2}))
+	assert.Len(t, page, 2)
+
+	fake.Expect(`^SELECT count\(\*\) FROM users$`).WillReturnRows([]string{"count"}, []driver.Value{int64(2)})
+	count, err := users.Count(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	fake.Expect(`^UPDATE users SET age = \$1,name = \$2 WHERE id = \$3$`).WillReturnResult(1)
+	affected, err := users.Update(ctx, db, &repoUser{ID: 7, Name: "Tom", Age: 19})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	fake.Expect(`^DELETE FROM users WHERE id = \$1$`).WillReturnResult(1)
+	affected, err = users.Delete(ctx, db, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	assert.NoError(t, fake.ExpectationsWereMet())
+}
+
+func TestRepositoryInTransaction(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+	users, err := NewRepository("users", &repoUser{}, RepositoryOption{})
+	assert.NoError(t, err)
+
+	fake.Expect(`^INSERT INTO users`).WillReturnRows([]string{"id"}, []driver.Value{int64(1)}, []driver.Value{int64(2)})
+	err = WithTransactionContext(ctx, db, nil, func(tx *sql.Tx) (bool, error) {
+		var ids []int
+		err := users.CreateMany(ctx, tx, []Record{&repoUser{Name: "Tom"}, &repoUser{Name: "Amy"}}, &ids)
+		assert.Equal(t, []int{1, 2}, ids)
+		return false, err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.Count(pqtest.EventBegin))
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+}
+
+func TestRepositoryKey(t *testing.T) {
+	ctx := context.Background()
+	db, fake := pqtest.New()
+
+	type device struct {
+		UUID string `db:"uuid,readonly"`
+		Name string `db:"name"`
+	}
+	devices, err := NewRepository("devices", device{}, RepositoryOption{Key: "uuid"})
+	assert.NoError(t, err)
+
+	fake.Expect(`^INSERT INTO devices \(name\) VALUES \(\$1\) RETURNING uuid$`).
+		WillReturnRows([]string{"uuid"}, []driver.Value{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"})
+	var key string
+	assert.NoError(t, devices.Create(ctx, db, &device{Name: "phone"}, &key))
+	assert.Equal(t, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", key)
+
+	// nothing is returned without keys
+	fake.Expect(`^INSERT INTO devices \(name\) VALUES \(\$1\),\(\$2\)$`).WillReturnResult(2)
+	assert.NoError(t, devices.CreateMany(ctx, db, []Record{&device{Name: "phone"}, &device{Name: "pad"}}, nil))
+
+	assert.Error(t, devices.Create(ctx, db, &device{Name: "phone"}, key))
+	assert.NoError(t, fake.ExpectationsWereMet())
+}
+
+func TestNewRepositoryInvalid(t *testing.T) {
+	_, err := NewRepository("users", 1, RepositoryOption{})
+	assert.Error(t, err)
+	_, err = NewRepository("users", repoUser{}, RepositoryOption{Key: "uuid"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,89 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Default values of `RetryOption`.
+const (
+	DefaultRetryMaxAttempts = 5
+	DefaultRetryBaseBackoff = 10 * time.Millisecond
+	DefaultRetryMaxBackoff  = time.Second
+)
+
+// RetryOption ...
+type RetryOption struct {
+	// Maximal number of attempts, including the first one.
+	MaxAttempts int
+
+	// Before the n-th retry, wait for a random duration in [0, min(MaxBackoff, BaseBackoff * 2^n)).
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Options to begin each transaction with, e.g. the isolation level.
+	TxOptions *sql.TxOptions
+}
+
+func (o RetryOption) withDefault() RetryOption {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if o.BaseBackoff <= 0 {
+		o.BaseBackoff = DefaultRetryBaseBackoff
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = DefaultRetryMaxBackoff
+	}
+	return o
+}
+
+func (o RetryOption) backoff(retry int) time.Duration {
+	d := o.MaxBackoff
+	if retry < 32 {
+		if b := o.BaseBackoff << uint(retry); b > 0 && b < d {
+			d = b
+		}
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// WithTransactionRetry ...
+func WithTransactionRetry(db *sql.DB, opt RetryOption, queries func(tx *sql.Tx) (bool, error)) (attempts int, err error) {
+	return WithTransactionRetryContext(context.Background(), db, opt, queries)
+}
+
+// WithTransactionRetryContext runs `queries` in a transaction as `WithTransactionContext` does,
+// but re-runs the whole transaction when it fails by a serialization failure or a deadlock, which are expected under SERIALIZABLE isolation or contention.
+// `queries` may thus be called several times and should not have side effects out of the transaction.
+// An aborted transaction is not retried, whatever the error is. The number of attempts made is returned.
+func WithTransactionRetryContext(ctx context.Context, db *sql.DB, opt RetryOption, queries func(tx *sql.Tx) (bool, error)) (attempts int, err error) {
+	opt = opt.withDefault()
+
+	for {
+		attempts++
+		var aborted bool
+		err = WithTransactionContext(ctx, db, opt.TxOptions, func(tx *sql.Tx) (abort bool, err error) {
+			abort, err = queries(tx)
+			aborted = abort
+			return
+		})
+		if err == nil || aborted || !IsSerializationError(err) || attempts >= opt.MaxAttempts {
+			return
+		}
+
+		wait := opt.backoff(attempts - 1)
+		glog.Warningf("retrying transaction in %v after attempt %v/%v: %v", wait, attempts, opt.MaxAttempts, err)
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(wait):
+		}
+	}
+}
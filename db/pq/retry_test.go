@@ -0,0 +1,96 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	opt := RetryOption{BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}.withDefault()
+	assert.Equal(t, DefaultRetryMaxAttempts, opt.MaxAttempts)
+	for retry := 0; retry < 100; retry++ {
+		d := opt.backoff(retry)
+		assert.True(t, d >= 0 && d < 5*time.Millisecond)
+		if retry == 0 {
+			assert.True(t, d < time.Millisecond)
+		}
+	}
+}
+
+func TestWithTransactionRetry(t *testing.T) {
+	ctx := context.Background()
+	opt := RetryOption{MaxAttempts: 3, BaseBackoff: time.Microsecond, MaxBackoff: time.Microsecond}
+
+	// serialization failures and deadlocks are retried until succeeded
+	db, fake := pqtest.New()
+	errs := []error{&pq.Error{Code: "40001"}, &pq.Error{Code: "40P01"}, nil}
+	var calls int
+	attempts, err := WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		calls++
+		return false, errs[calls-1]
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 3, fake.Count(pqtest.EventBegin))
+	assert.Equal(t, 2, fake.Count(pqtest.EventRollback))
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+
+	// up to the max attempts
+	db, fake = pqtest.New()
+	attempts, err = WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		return false, &pq.Error{Code: "40001"}
+	})
+	assert.True(t, IsSerializationError(err))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 3, fake.Count(pqtest.EventBegin))
+
+	// other errors are not retried
+	attempts, err = WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		return false, &pq.Error{Code: "23505"}
+	})
+	assert.True(t, IsUniqueViolation(err))
+	assert.Equal(t, 1, attempts)
+	attempts, err = WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		return false, fmt.Errorf("failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// neither are aborted transactions
+	db, fake = pqtest.New()
+	attempts, err = WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		return true, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+	attempts, err = WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		return true, &pq.Error{Code: "40001"}
+	})
+	assert.True(t, IsSerializationError(err))
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 2, fake.Count(pqtest.EventRollback))
+	assert.Equal(t, 0, fake.Count(pqtest.EventCommit))
+}
+
+func TestWithTransactionRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	db, fake := pqtest.New()
+
+	// canceled while waiting to retry
+	opt := RetryOption{MaxAttempts: 3, BaseBackoff: time.Hour, MaxBackoff: time.Hour}
+	attempts, err := WithTransactionRetryContext(ctx, db, opt, func(tx *sql.Tx) (bool, error) {
+		cancel()
+		return false, &pq.Error{Code: "40001"}
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, fake.Count(pqtest.EventBegin))
+}
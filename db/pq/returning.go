@@ -0,0 +1,124 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// BatchInsertReturning ...
+func BatchInsertReturning(dbase *sql.DB, table TableName, records []Record, opt InsertOption, dest interface{}) (err error) {
+	return BatchInsertReturningContext(context.Background(), dbase, table, records, opt, dest)
+}
+
+// BatchInsertReturningContext ...
+func BatchInsertReturningContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt InsertOption, dest interface{}) (err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		err = BatchInsertReturningTransactionContext(ctx, tx, table, records, opt, dest)
+		if opt.Abort != nil {
+			abort = *opt.Abort
+		}
+		return
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// BatchInsertReturningTransaction ...
+func BatchInsertReturningTransaction(tx *sql.Tx, table TableName, records []Record, opt InsertOption, dest interface{}) (err error) {
+	return BatchInsertReturningTransactionContext(context.Background(), tx, table, records, opt, dest)
+}
+
+// BatchInsertReturningTransactionContext inserts records as `BatchInsertTransaction` does,
+// but appends the `opt.Returning` columns of inserted rows to `dest` as `ScanRows` does, which can be a pointer to
+//    - a slice of keys of any type, e.g. `[]string` for UUIDs or `[]int64`, when returning a single column.
+//    - a slice of structs, e.g. for composite keys, or the input struct type with `Returning: []ColumnName{"*"}` to get full rows back.
+//    - a slice of `map[string]interface{}`.
+func BatchInsertReturningTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt InsertOption, dest interface{}) (err error) {
+	if opt.NoID {
+		err = fmt.Errorf("NoID conflicts with returning")
+		glog.Error(err)
+		return
+	}
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Slice {
+		err = fmt.Errorf("destination must be a pointer to slice, got %T", dest)
+		glog.Error(err)
+		return
+	}
+	opt.Returning = resolveReturning(opt.Returning, val.Elem().Type().Elem())
+
+	if len(records) == 0 {
+		return
+	}
+
+	columns, err := insertColumns(table, records, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	stmts := newStmtCache(tx)
+	defer stmts.close()
+
+	err = forEachBatch(ctx, records, columns, opt, func(recs []Record) (err error) {
+		query, args, empty, err := MakeBatchInsertQuery(table, recs, columns, opt)
+		if err != nil || empty {
+			return
+		}
+
+		start := time.Now()
+		var counter countingRows
+		defer func() {
+			observe(ctx, QueryKindQuery, query, len(args), start, counter.count, err)
+		}()
+
+		stt, err := stmts.prepare(ctx, query)
+		if err != nil {
+			return
+		}
+		rows, err := stt.QueryContext(ctx, args...)
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+		counter.Rows = rows
+		return scanRows(&counter, dest)
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	return
+}
+
+// resolveReturning expands `*` into the columns of the struct to scan into, which may not cover all columns of the table.
+func resolveReturning(returning []ColumnName, elemType reflect.Type) []ColumnName {
+	if len(returning) == 0 {
+		return []ColumnName{"id"}
+	}
+	if len(returning) != 1 || returning[0] != "*" {
+		return returning
+	}
+
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if !isStructType(elemType) {
+		return returning
+	}
+
+	var columns []ColumnName
+	for _, f := range structColumns(elemType) {
+		columns = append(columns, ColumnName(f.column))
+	}
+	return columns
+}
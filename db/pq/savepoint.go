@@ -0,0 +1,87 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+var savepointCount uint64
+
+// WithSavepoint ...
+func WithSavepoint(tx *sql.Tx, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	return WithSavepointContext(context.Background(), tx, queries)
+}
+
+// WithSavepointContext runs `queries` inside a savepoint of an existing transaction, which behaves like a nested `WithTransaction`:
+// if `queries` fails or aborts, only what it did is rolled back, and the outer transaction can go on.
+// The error of `queries` is still returned for the caller to decide whether to go on.
+// If `queries` panics, it is rolled back as well, and the panic goes on.
+// Savepoints can be nested arbitrarily, e.g.
+//    WithTransaction(db, func(tx *sql.Tx) (bool, error) {
+//        // ...
+//        if err := WithSavepoint(tx, insertOptionalStuff); err != nil {
+//            // the outer transaction is intact
+//        }
+//        return false, nil
+//    })
+func WithSavepointContext(ctx context.Context, tx *sql.Tx, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	var abort bool
+
+	name := fmt.Sprintf("pq_savepoint_%d", atomic.AddUint64(&savepointCount, 1))
+
+	if _, err = tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		glog.Error(err)
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			// undo what `queries` did, and leave the panic to the caller
+			if _, e := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); e != nil {
+				glog.Error(e)
+			}
+			panic(p)
+		}
+		if err != nil || abort {
+			if _, e := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name); e != nil {
+				glog.Error(e)
+				if err == nil {
+					err = e
+				}
+				return
+			}
+		}
+		if _, e := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name); e != nil {
+			glog.Error(e)
+			if err == nil {
+				err = e
+			}
+			return
+		}
+	}()
+
+	abort, err = queries(tx)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	return
+}
+
+// WithSavepoint executes pending sqls and then runs `queries` inside a savepoint as `WithSavepoint` does.
+// Unlike `Exec`, a failure of `queries` does not roll back the whole transaction.
+func (b *Transaction) WithSavepoint(queries func(tx *sql.Tx) (bool, error)) (err error) {
+	return b.WithSavepointContext(context.Background(), queries)
+}
+
+// WithSavepointContext ...
+func (b *Transaction) WithSavepointContext(ctx context.Context, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	if err = b.ExecContext(ctx); err != nil {
+		return
+	}
+	return WithSavepointContext(ctx, b.tx, queries)
+}
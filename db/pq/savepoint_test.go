@@ -0,0 +1,115 @@
+package pq
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+var savepointPattern = regexp.MustCompile(`pq_savepoint_\d+`)
+
+// savepointStatements replaces savepoint names by their order of appearance, e.g. "SAVEPOINT sp1".
+func savepointStatements(fake *pqtest.Fake) []string {
+	names := make(map[string]string)
+	var stmts []string
+	for _, s := range fake.Statements() {
+		stmts = append(stmts, savepointPattern.ReplaceAllStringFunc(s, func(name string) string {
+			if _, ok := names[name]; !ok {
+				names[name] = fmt.Sprintf("sp%d", len(names)+1)
+			}
+			return names[name]
+		}))
+	}
+	return stmts
+}
+
+func TestWithSavepoint(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`^INSERT INTO pets`).WillReturnError(fmt.Errorf("boom"))
+
+	err := WithTransaction(db, func(tx *sql.Tx) (bool, error) {
+		// released on success
+		err := WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+			_, err := tx.Exec(`INSERT INTO users (name) VALUES ('Tom')`)
+			return false, err
+		})
+		assert.NoError(t, err)
+
+		// rolled back on error, which is returned
+		err = WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+			_, err := tx.Exec(`INSERT INTO pets (name) VALUES ('Spike')`)
+			return false, err
+		})
+		assert.EqualError(t, err, "boom")
+
+		// rolled back on abort
+		err = WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+			return true, nil
+		})
+		assert.NoError(t, err)
+
+		// the outer transaction goes on
+		return false, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"SAVEPOINT sp1",
+		"INSERT INTO users (name) VALUES ('Tom')",
+		"RELEASE SAVEPOINT sp1",
+		"SAVEPOINT sp2",
+		"INSERT INTO pets (name) VALUES ('Spike')",
+		"ROLLBACK TO SAVEPOINT sp2",
+		"RELEASE SAVEPOINT sp2",
+		"SAVEPOINT sp3",
+		"ROLLBACK TO SAVEPOINT sp3",
+		"RELEASE SAVEPOINT sp3",
+	}, savepointStatements(fake))
+	assert.Equal(t, 1, fake.Count(pqtest.EventCommit))
+}
+
+func TestWithSavepointNested(t *testing.T) {
+	db, fake := pqtest.New()
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	err = WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+		return false, WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+			return false, fmt.Errorf("boom")
+		})
+	})
+	assert.EqualError(t, err, "boom")
+
+	// names are distinct, and the inner savepoint is done first
+	assert.Equal(t, []string{
+		"SAVEPOINT sp1",
+		"SAVEPOINT sp2",
+		"ROLLBACK TO SAVEPOINT sp2",
+		"RELEASE SAVEPOINT sp2",
+		"ROLLBACK TO SAVEPOINT sp1",
+		"RELEASE SAVEPOINT sp1",
+	}, savepointStatements(fake))
+}
+
+func TestWithSavepointPanic(t *testing.T) {
+	db, fake := pqtest.New()
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	defer tx.Rollback()
+
+	assert.PanicsWithValue(t, "boom", func() {
+		WithSavepoint(tx, func(tx *sql.Tx) (bool, error) {
+			tx.Exec(`INSERT INTO users (name) VALUES ('Tom')`)
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{
+		"SAVEPOINT sp1",
+		"INSERT INTO users (name) VALUES ('Tom')",
+		"ROLLBACK TO SAVEPOINT sp1",
+	}, savepointStatements(fake))
+}
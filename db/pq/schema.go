@@ -0,0 +1,252 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// ColumnInfo describes a column of a table in `information_schema.columns`.
+type ColumnInfo struct {
+	Name string `db:"column_name"`
+
+	// e.g. "integer", "ARRAY" and "USER-DEFINED"
+	DataType string `db:"data_type"`
+
+	// e.g. "int4", "_text" for an array of text, or the name of an enum
+	UDTName string `db:"udt_name"`
+
+	Nullable bool `db:"nullable"`
+
+	// A default, identity or generated column can be omitted on insertion.
+	HasDefault bool `db:"has_default"`
+}
+
+// TableColumns lists columns of `table` in their order, which can be qualified by a schema, or otherwise in the current schema.
+func TableColumns(ctx context.Context, q QueryerContext, table TableName) (columns []ColumnInfo, err error) {
+	// NULL for the current schema
+	var schema interface{}
+	qualifier, name := table.split()
+	if qualifier != "" {
+		schema = qualifier
+	}
+
+	query := `
+	SELECT
+		column_name,
+		data_type,
+		udt_name,
+		is_nullable = 'YES' AS nullable,
+		(column_default IS NOT NULL OR is_identity = 'YES' OR is_generated = 'ALWAYS') AS has_default
+	FROM information_schema.columns
+	WHERE table_schema = COALESCE($1, current_schema()) AND table_name = $2
+	ORDER BY ordinal_position`
+	if err = SelectContext(ctx, q, &columns, query, schema, name); err != nil {
+		return
+	}
+	if len(columns) == 0 {
+		err = fmt.Errorf("table %s is not found", table)
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// DriftKind ...
+type DriftKind string
+
+// Kinds of drifts between a struct and a table.
+const (
+	// A `db` tag names a column missing from the table.
+	DriftMissingColumn DriftKind = "missing column"
+
+	// A field can not hold values of the column type.
+	DriftTypeMismatch DriftKind = "type mismatch"
+
+	// A NOT NULL column without default is omitted on insertion, since the field is read-only or missing,
+	// or its zero value is omitted by `MapColumn` without `keepempty`.
+	DriftOmittedNotNull DriftKind = "omitted not null"
+)
+
+// Drift is a mismatch between a field of a struct and a column of a table.
+type Drift struct {
+	Kind   DriftKind
+	Column string
+	Detail string
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s", d.Kind, d.Column, d.Detail)
+}
+
+// CheckSchema compares the `db` tags and field types of `prototype`, which is a struct or a pointer to struct, against `table`,
+// e.g. at startup or in a test, and reports drifts, which are not errors.
+// Columns filled under conventions of `table` are not reported as omitted.
+func CheckSchema(ctx context.Context, q QueryerContext, table TableName, prototype Record) (drifts []Drift, err error) {
+	columns, err := TableColumns(ctx, q, table)
+	if err != nil {
+		return
+	}
+	drifts = compareSchema(table, reflect.TypeOf(prototype), columns)
+	return
+}
+
+func compareSchema(table TableName, typ reflect.Type, columns []ColumnInfo) (drifts []Drift) {
+	structFields := structColumns(typ)
+	fields := make(map[string]columnField)
+	for _, f := range structFields {
+		fields[f.column] = f
+	}
+	infos := make(map[string]ColumnInfo)
+	for _, c := range columns {
+		infos[c.Name] = c
+	}
+
+	// fields in the order of the struct
+	for _, f := range structFields {
+		info, ok := infos[f.column]
+		if !ok {
+			drifts = append(drifts, Drift{
+				Kind:   DriftMissingColumn,
+				Column: f.column,
+				Detail: fmt.Sprintf("no such column in %s", table),
+			})
+			continue
+		}
+		if accepted := acceptedTypes(f.typ, f.json); accepted != nil && !accepted[info.UDTName] && !acceptsEnum(f.typ, info) {
+			drifts = append(drifts, Drift{
+				Kind:   DriftTypeMismatch,
+				Column: f.column,
+				Detail: fmt.Sprintf("%v can not hold %s", f.typ, info.UDTName),
+			})
+		}
+	}
+
+	filled := make(map[string]bool)
+	if c := conventionsOf(table); c != nil {
+		filled[string(c.CreatedAt)] = true
+		filled[string(c.UpdatedAt)] = true
+		filled[string(c.Version)] = true
+	}
+
+	// columns in the order of the table
+	for _, info := range columns {
+		if info.Nullable || info.HasDefault || filled[info.Name] {
+			continue
+		}
+		f, ok := fields[info.Name]
+		switch {
+		case !ok:
+			drifts = append(drifts, Drift{
+				Kind:   DriftOmittedNotNull,
+				Column: info.Name,
+				Detail: "no field maps to the column",
+			})
+		case f.readOnly:
+			drifts = append(drifts, Drift{
+				Kind:   DriftOmittedNotNull,
+				Column: info.Name,
+				Detail: "the field is read-only",
+			})
+		case !f.keepEmpty:
+			drifts = append(drifts, Drift{
+				Kind:   DriftOmittedNotNull,
+				Column: info.Name,
+				Detail: "the zero value of the field is omitted, consider keepempty",
+			})
+		}
+	}
+
+	return
+}
+
+var (
+	bytesType       = reflect.TypeOf([]byte(nil))
+	nullStringType  = reflect.TypeOf(sql.NullString{})
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullInt32Type   = reflect.TypeOf(sql.NullInt32{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+	nullTimeType    = reflect.TypeOf(sql.NullTime{})
+	pqNullTimeType  = reflect.TypeOf(pq.NullTime{})
+)
+
+func typeSet(names ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
+
+var (
+	boolTypes   = typeSet("bool")
+	intTypes    = typeSet("int2", "int4", "int8")
+	floatTypes  = typeSet("float4", "float8", "numeric")
+	stringTypes = typeSet("text", "varchar", "bpchar", "char", "name", "citext", "uuid", "json", "jsonb", "xml", "inet", "cidr", "macaddr", "numeric", "interval")
+	bytesTypes  = typeSet("bytea", "json", "jsonb")
+	timeTypes   = typeSet("timestamp", "timestamptz", "date", "time", "timetz")
+	jsonTypes   = typeSet("json", "jsonb")
+)
+
+// acceptedTypes tells the column types, by `udt_name`, whose values a field of `typ` can hold,
+// or nil for types which are not checked, e.g. custom scanners.
+func acceptedTypes(typ reflect.Type, isJSON bool) map[string]bool {
+	if isJSON {
+		return jsonTypes
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ {
+	case bytesType:
+		return bytesTypes
+	case timeType, nullTimeType, pqNullTimeType:
+		return timeTypes
+	case nullStringType:
+		return stringTypes
+	case nullInt64Type, nullInt32Type:
+		return intTypes
+	case nullFloat64Type:
+		return floatTypes
+	case nullBoolType:
+		return boolTypes
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return boolTypes
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return intTypes
+	case reflect.Float32, reflect.Float64:
+		return floatTypes
+	case reflect.String:
+		return stringTypes
+	case reflect.Slice:
+		// arrays are named by their element type prefixed by an underscore
+		elem := acceptedTypes(typ.Elem(), false)
+		if elem == nil {
+			return nil
+		}
+		arrays := make(map[string]bool)
+		for name := range elem {
+			arrays["_"+name] = true
+		}
+		return arrays
+	}
+	return nil
+}
+
+// acceptsEnum tells if a string field can hold an enum or other user-defined column, which is checked loosely.
+func acceptsEnum(typ reflect.Type, info ColumnInfo) bool {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.String && info.DataType == "USER-DEFINED"
+}
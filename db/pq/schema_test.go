@@ -0,0 +1,83 @@
+package pq
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hxhxhx88/common/db/pq/pqtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaUser struct {
+	ID        int            `db:"id,readonly"`
+	Name      string         `db:"name"`
+	Age       int            `db:"age,keepempty"`
+	Nickname  *string        `db:"nick_name"`
+	Tags      []string       `db:"tags"`
+	Scores    []int          `db:"scores"`
+	Profile   map[string]int `db:"profile,json"`
+	Status    string         `db:"status"`
+	CreatedAt time.Time      `db:"created_at,readonly"`
+}
+
+func TestCompareSchema(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "id", DataType: "integer", UDTName: "int4", HasDefault: true},
+		{Name: "name", DataType: "text", UDTName: "text"},
+		{Name: "age", DataType: "integer", UDTName: "int4"},
+		{Name: "scores", DataType: "ARRAY", UDTName: "_text", Nullable: true},
+		{Name: "tags", DataType: "ARRAY", UDTName: "_varchar", Nullable: true},
+		{Name: "profile", DataType: "jsonb", UDTName: "jsonb", Nullable: true},
+		{Name: "status", DataType: "USER-DEFINED", UDTName: "user_status", Nullable: true},
+		{Name: "created_at", DataType: "timestamp with time zone", UDTName: "timestamptz", HasDefault: true},
+		{Name: "email", DataType: "text", UDTName: "text"},
+	}
+
+	drifts := compareSchema("users", reflect.TypeOf(schemaUser{}), columns)
+	assert.Equal(t, []Drift{
+		{Kind: DriftMissingColumn, Column: "nick_name", Detail: "no such column in users"},
+		{Kind: DriftTypeMismatch, Column: "scores", Detail: "[]int can not hold _text"},
+		{Kind: DriftOmittedNotNull, Column: "name", Detail: "the zero value of the field is omitted, consider keepempty"},
+		{Kind: DriftOmittedNotNull, Column: "email", Detail: "no field maps to the column"},
+	}, drifts)
+}
+
+func TestCompareSchemaConventions(t *testing.T) {
+	type post struct {
+		ID    int    `db:"id,readonly"`
+		Title string `db:"title,keepempty"`
+	}
+	columns := []ColumnInfo{
+		{Name: "id", UDTName: "int8", HasDefault: true},
+		{Name: "title", UDTName: "text"},
+		{Name: "created_at", UDTName: "timestamptz"},
+		{Name: "updated_at", UDTName: "timestamptz"},
+		{Name: "version", UDTName: "int4"},
+	}
+	// registered in conventions_test.go
+	assert.Empty(t, compareSchema("conv_posts", reflect.TypeOf(post{}), columns))
+	assert.Len(t, compareSchema("posts", reflect.TypeOf(post{}), columns), 3)
+}
+
+func TestCheckSchema(t *testing.T) {
+	db, fake := pqtest.New()
+	fake.Expect(`FROM information_schema.columns`).WillReturnRows(
+		[]string{"column_name", "data_type", "udt_name", "nullable", "has_default"},
+		[]driver.Value{"id", "integer", "int4", false, true},
+		[]driver.Value{"name", "text", "text", true, false},
+	)
+
+	type user struct {
+		ID   int    `db:"id,readonly"`
+		Name string `db:"name"`
+	}
+	drifts, err := CheckSchema(context.Background(), db, "public.users", &user{})
+	assert.NoError(t, err)
+	assert.Empty(t, drifts)
+
+	args := fake.Events()[len(fake.Events())-1].Args
+	assert.Equal(t, []driver.Value{"public", "users"}, args)
+}
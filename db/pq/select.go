@@ -0,0 +1,272 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// Queryer is implemented by both `*sql.DB` and `*sql.Tx`.
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// QueryerContext is implemented by both `*sql.DB` and `*sql.Tx`.
+type QueryerContext interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Select runs the query and scans the result into `dest` by matching column names to `db` tags, which is the reverse of `MapColumn`, e.g.
+// 	  struct Record {
+// 	 	ID int `db:"id"`
+// 		Nickname *string `db:"nickname"` // pointer field is NULLable
+// 		Tags []string `db:"tags"` // slice is scanned by `pq.Array`
+// 		Avatar []byte `db:"avatar"` // `[]byte` is scanned as `bytea`
+//    }
+// `dest` can be a pointer to
+//    - a slice of structs or struct pointers, to which all rows are appended.
+//    - a slice of `map[string]interface{}`, to which all rows are appended by column names.
+//    - a slice of other types, to which the only column of all rows is appended.
+//    - a struct, into which the first row is scanned, and `sql.ErrNoRows` is returned if there is no row.
+// Every result column must have a corresponding field.
+func Select(q Queryer, dest interface{}, query string, args ...interface{}) (err error) {
+	return selectObserved(context.Background(), dest, query, args, func() (*sql.Rows, error) {
+		return q.Query(query, args...)
+	})
+}
+
+// SelectContext ...
+func SelectContext(ctx context.Context, q QueryerContext, dest interface{}, query string, args ...interface{}) (err error) {
+	return selectObserved(ctx, dest, query, args, func() (*sql.Rows, error) {
+		return q.QueryContext(ctx, query, args...)
+	})
+}
+
+// selectObserved scans rows returned by `run` into `dest`, and tells hooks.
+func selectObserved(ctx context.Context, dest interface{}, query string, args []interface{}, run func() (*sql.Rows, error)) (err error) {
+	start := time.Now()
+	var counter countingRows
+	defer func() {
+		e := err
+		if e == sql.ErrNoRows {
+			// not a failure of the query
+			e = nil
+		}
+		observe(ctx, QueryKindQuery, query, len(args), start, counter.count, e)
+	}()
+
+	rows, err := run()
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	counter.Rows = rows
+	if err = scanRows(&counter, dest); err != nil {
+		if err != sql.ErrNoRows {
+			glog.Error(err)
+		}
+		return
+	}
+
+	return
+}
+
+// ScanRows scans rows into `dest` as `Select` does.
+func ScanRows(rows *sql.Rows, dest interface{}) error {
+	return scanRows(rows, dest)
+}
+
+// rowIterator is implemented by `*sql.Rows`.
+type rowIterator interface {
+	Next() bool
+	Err() error
+	Columns() ([]string, error)
+	Scan(dest ...interface{}) error
+}
+
+func scanRows(rows rowIterator, dest interface{}) (err error) {
+	val := reflect.ValueOf(dest)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		err = fmt.Errorf("destination must be a non-nil pointer, got %T", dest)
+		return
+	}
+	val = val.Elem()
+
+	switch val.Kind() {
+	case reflect.Struct:
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
+				return
+			}
+			err = sql.ErrNoRows
+			return
+		}
+		scanner, e := newStructScanner(rows, val.Type())
+		if e != nil {
+			err = e
+			return
+		}
+		if err = scanner.scan(rows, val); err != nil {
+			return
+		}
+	case reflect.Slice:
+		elemType := val.Type().Elem()
+		isPtr := elemType.Kind() == reflect.Ptr && isStructType(elemType.Elem())
+		if isPtr {
+			elemType = elemType.Elem()
+		}
+
+		// a slice of non-struct values is filled by a single column
+		scan := func(elem reflect.Value) error {
+			return rows.Scan(scanDest(elem))
+		}
+		if elemType == mapType {
+			columns, e := rows.Columns()
+			if e != nil {
+				err = e
+				return
+			}
+			scan = func(elem reflect.Value) error {
+				m, err := scanMap(rows, columns)
+				if err != nil {
+					return err
+				}
+				elem.Set(reflect.ValueOf(m))
+				return nil
+			}
+		} else if isStructType(elemType) {
+			scanner, e := newStructScanner(rows, elemType)
+			if e != nil {
+				err = e
+				return
+			}
+			scan = func(elem reflect.Value) error {
+				return scanner.scan(rows, elem)
+			}
+		} else {
+			columns, e := rows.Columns()
+			if e != nil {
+				err = e
+				return
+			}
+			if len(columns) != 1 {
+				err = fmt.Errorf("expect exactly 1 column to scan into %T, got %d", dest, len(columns))
+				return
+			}
+		}
+
+		for rows.Next() {
+			elem := reflect.New(elemType)
+			if err = scan(elem.Elem()); err != nil {
+				return
+			}
+			if isPtr {
+				val.Set(reflect.Append(val, elem))
+			} else {
+				val.Set(reflect.Append(val, elem.Elem()))
+			}
+		}
+	default:
+		err = fmt.Errorf("destination must point to a struct or a slice, got %T", dest)
+		return
+	}
+
+	return rows.Err()
+}
+
+// scanMap scans a row into a map by column names.
+func scanMap(rows rowIterator, columns []string) (m map[string]interface{}, err error) {
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err = rows.Scan(ptrs...); err != nil {
+		return
+	}
+	m = make(map[string]interface{})
+	for i, col := range columns {
+		m[col] = values[i]
+	}
+	return
+}
+
+// structScanner scans rows of the same columns into structs of the same type.
+type structScanner struct {
+	// field for each column
+	fields []columnField
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	mapType  = reflect.TypeOf(map[string]interface{}{})
+)
+
+// isStructType tells if a type is a struct to be scanned by fields.
+func isStructType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && typ != timeType
+}
+
+func newStructScanner(rows rowIterator, typ reflect.Type) (s *structScanner, err error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+
+	fieldByColumn := columnFields(typ)
+
+	s = &structScanner{}
+	for _, col := range columns {
+		field, ok := fieldByColumn[col]
+		if !ok {
+			err = fmt.Errorf("missing field for column %s in %v", col, typ)
+			return
+		}
+		s.fields = append(s.fields, field)
+	}
+
+	return
+}
+
+func (s *structScanner) scan(rows rowIterator, val reflect.Value) error {
+	dest := make([]interface{}, len(s.fields))
+	for i, field := range s.fields {
+		value := fieldByIndexAlloc(val, field.index)
+		if field.json {
+			dest[i] = jsonScanner{value.Addr().Interface()}
+		} else {
+			dest[i] = scanDest(value)
+		}
+	}
+	return rows.Scan(dest...)
+}
+
+// columnFields maps columns to fields of a struct type, including read-only ones.
+func columnFields(typ reflect.Type) map[string]columnField {
+	fields := make(map[string]columnField)
+	for _, f := range structColumns(typ) {
+		fields[f.column] = f
+	}
+	return fields
+}
+
+// scanDest wraps a field to be scanned in the same way `mapColumn` wraps it for inserting.
+func scanDest(field reflect.Value) interface{} {
+	addr := field.Addr().Interface()
+	if field.Kind() == reflect.Slice {
+		if _, ok := addr.(*[]byte); ok {
+			// `[]byte` corresponds to `bytea` in PostgreSQL and we should do nothing
+			return addr
+		}
+		return pq.Array(addr)
+	}
+	// pointer fields are handled by `database/sql`, which leaves them nil for NULL.
+	return addr
+}
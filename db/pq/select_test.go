@@ -0,0 +1,30 @@
+package pq
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnFields(t *testing.T) {
+	fields := columnFields(reflect.TypeOf(dbRecord{}))
+	assert.Equal(t, 7, len(fields))
+	assert.Equal(t, []int{0}, fields["name"].index)
+	assert.Equal(t, []int{6}, fields["files"].index)
+	_, ok := fields["city"] // private field should be ignored
+	assert.False(t, ok)
+}
+
+func TestScanDest(t *testing.T) {
+	var r struct {
+		Files  []string
+		Avatar []byte
+		Age    *int
+	}
+	val := reflect.ValueOf(&r).Elem()
+	assert.Equal(t, pq.Array(&r.Files), scanDest(val.Field(0)))
+	assert.Equal(t, &r.Avatar, scanDest(val.Field(1)))
+	assert.Equal(t, &r.Age, scanDest(val.Field(2)))
+}
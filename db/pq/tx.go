@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/golang/glog"
@@ -14,7 +15,13 @@ type Transaction struct {
 
 // NewTransaction ...
 func NewTransaction(db *sql.DB) (*Transaction, error) {
-	t, err := db.Begin()
+	return NewTransactionContext(context.Background(), db, nil)
+}
+
+// NewTransactionContext begins a transaction with `opts`, which can be nil.
+// The transaction is rolled back if `ctx` is done before committed.
+func NewTransactionContext(ctx context.Context, db *sql.DB, opts *sql.TxOptions) (*Transaction, error) {
+	t, err := beginTx(ctx, db, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -28,14 +35,19 @@ func NewTransaction(db *sql.DB) (*Transaction, error) {
 
 // Exec ...
 func (b *Transaction) Exec() (err error) {
+	return b.ExecContext(context.Background())
+}
+
+// ExecContext ...
+func (b *Transaction) ExecContext(ctx context.Context) (err error) {
 	defer func() {
 		if err != nil {
-			b.tx.Rollback()
+			rollbackTx(ctx, b.tx)
 		}
 	}()
 
 	for _, ex := range b.execs {
-		err = ex.exec(b.tx)
+		err = ex.exec(ctx, b.tx)
 		if err != nil {
 			return
 		}
@@ -49,20 +61,25 @@ func (b *Transaction) Exec() (err error) {
 
 // Commit ...
 func (b *Transaction) Commit() (err error) {
+	return b.CommitContext(context.Background())
+}
+
+// CommitContext ...
+func (b *Transaction) CommitContext(ctx context.Context) (err error) {
 	defer func() {
 		if err != nil {
-			b.tx.Rollback()
+			rollbackTx(ctx, b.tx)
 		}
 	}()
 
 	// exec tail sqls
-	err = b.Exec()
+	err = b.ExecContext(ctx)
 	if err != nil {
 		return
 	}
 
 	// commit
-	err = b.tx.Commit()
+	err = commitTx(ctx, b.tx)
 	if err != nil {
 		return
 	}
@@ -72,21 +89,32 @@ func (b *Transaction) Commit() (err error) {
 
 // WithTransaction ...
 func WithTransaction(db *sql.DB, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	return WithTransactionContext(context.Background(), db, nil, queries)
+}
+
+// WithTransactionContext begins a transaction with `opts`, which can be nil, to run `queries`.
+// The transaction is rolled back if `ctx` is done before committed, thus `queries` should also use `ctx` for its statements.
+func WithTransactionContext(ctx context.Context, db *sql.DB, opts *sql.TxOptions, queries func(tx *sql.Tx) (bool, error)) (err error) {
+	return withTransaction(ctx, db, opts, queries)
+}
+
+// withTransaction is `WithTransactionContext` on either a `*sql.DB` or a `*sql.Conn`.
+func withTransaction(ctx context.Context, b txBeginner, opts *sql.TxOptions, queries func(tx *sql.Tx) (bool, error)) (err error) {
 	var abort bool
 
-	tx, err := db.Begin()
+	tx, err := beginTx(ctx, b, opts)
 	if err != nil {
 		glog.Error(err)
 		return
 	}
 	defer func() {
 		if err != nil || abort {
-			tx.Rollback()
+			rollbackTx(ctx, tx)
 			return
 		}
-		if err = tx.Commit(); err != nil {
+		if err = commitTx(ctx, tx); err != nil {
 			glog.Error(err)
-			tx.Rollback()
+			rollbackTx(ctx, tx)
 			return
 		}
 	}()
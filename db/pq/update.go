@@ -0,0 +1,341 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/lib/pq"
+)
+
+// Execer is implemented by both `*sql.DB` and `*sql.Tx`.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// UpdateOption ...
+type UpdateOption struct {
+	// Columns identifying the row to update, which go to `WHERE` instead of `SET`.
+	KeyColumns []ColumnName
+
+	// Columns whose value is empty should also be updated instead of omitted.
+	// Key columns are always kept.
+	KeepEmptyValueColums []ColumnName
+}
+
+// Update ...
+func Update(q Execer, table TableName, record Record, opt UpdateOption) (affected int64, err error) {
+	return UpdateContext(context.Background(), q, table, record, opt)
+}
+
+// UpdateContext updates the row identified by the key columns of `record` with its other columns,
+// where empty values are omitted as `MapColumnWithOption` does, and returns the number of affected rows.
+// Under `Conventions.Version`, a `*ConflictError` is returned if no row is updated due to a stale version.
+func UpdateContext(ctx context.Context, q Execer, table TableName, record Record, opt UpdateOption) (affected int64, err error) {
+	query, args, err := MakeUpdateQuery(table, record, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	res, err := execObserved(ctx, q, query, args)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	if affected, err = res.RowsAffected(); err != nil {
+		glog.Error(err)
+		return
+	}
+
+	if affected == 0 {
+		keys, _, _, _ := splitUpdateColumns(table, record, opt)
+		if conventionsOf(table).versioned(keys) {
+			err = &ConflictError{Table: table, Conflicts: 1}
+			return
+		}
+	}
+	return
+}
+
+// MakeUpdateQuery makes a query like
+//    UPDATE users SET name = $1, age = $2 WHERE id = $3
+// or under `DefaultConventions`
+//    UPDATE users SET name = $1, age = $2, updated_at = $3, version = version + 1 WHERE id = $4 AND version = $5 AND deleted_at IS NULL
+func MakeUpdateQuery(table TableName, record Record, opt UpdateOption) (query string, args []interface{}, err error) {
+	keys, sets, values, err := splitUpdateColumns(table, record, opt)
+	if err != nil {
+		return
+	}
+
+	var setClauses, whereClauses []string
+	for _, col := range sets {
+		args = append(args, values[col])
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", col, len(args)))
+	}
+	for _, col := range keys {
+		args = append(args, values[col])
+		whereClauses = append(whereClauses, fmt.Sprintf("%s = $%d", col, len(args)))
+	}
+	if c := conventionsOf(table); c != nil {
+		if c.Version != "" {
+			setClauses = append(setClauses, fmt.Sprintf("%s = %s + 1", c.Version, c.Version))
+		}
+		if c.DeletedAt != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("%s IS NULL", c.DeletedAt))
+		}
+	}
+
+	query = fmt.Sprintf(`UPDATE %s SET %s WHERE %s`,
+		table,
+		strings.Join(setClauses, ","),
+		strings.Join(whereClauses, " AND "),
+	)
+	return
+}
+
+// splitUpdateColumns maps a record into columns, telling key columns apart from those to set, which are sorted.
+// Under conventions of `table`, `UpdatedAt` is set to the current time, and `Version` of the record is a key instead,
+// while increasing versions and skipping soft deleted rows are left to queries.
+func splitUpdateColumns(table TableName, record Record, opt UpdateOption) (keys []string, sets []string, values map[string]interface{}, err error) {
+	if len(opt.KeyColumns) == 0 {
+		err = fmt.Errorf("missing key columns")
+		return
+	}
+
+	values = mapColumnKeeping(record, opt.KeepEmptyValueColums)
+
+	conv := conventionsOf(table)
+	if conv != nil {
+		if conv.UpdatedAt != "" {
+			values[string(conv.UpdatedAt)] = time.Now()
+		}
+		if conv.Version != "" {
+			delete(values, string(conv.Version))
+		}
+	}
+
+	// key columns are kept even if empty or read-only
+	isKey := make(map[string]bool)
+	for _, c := range opt.KeyColumns {
+		col := string(c)
+		v, ok := columnValue(record, col)
+		if !ok {
+			err = fmt.Errorf("missing key column %s", col)
+			return
+		}
+		values[col] = v
+		isKey[col] = true
+		keys = append(keys, col)
+	}
+	if conv != nil && conv.Version != "" && !isKey[string(conv.Version)] {
+		// records without the version are updated unconditionally
+		if v, ok := columnValue(record, string(conv.Version)); ok {
+			values[string(conv.Version)] = v
+			isKey[string(conv.Version)] = true
+			keys = append(keys, string(conv.Version))
+		}
+	}
+	for col := range values {
+		if !isKey[col] {
+			sets = append(sets, col)
+		}
+	}
+	if len(sets) == 0 {
+		err = fmt.Errorf("no column to update")
+		return
+	}
+	sort.Strings(sets)
+
+	return
+}
+
+// BatchUpdate ...
+func BatchUpdate(dbase *sql.DB, table TableName, records []Record, opt UpdateOption) (affected int64, err error) {
+	return BatchUpdateContext(context.Background(), dbase, table, records, opt)
+}
+
+// BatchUpdateContext ...
+func BatchUpdateContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt UpdateOption) (affected int64, err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		affected, err = BatchUpdateTransactionContext(ctx, tx, table, records, opt)
+		return
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// BatchUpdateTransaction ...
+func BatchUpdateTransaction(tx *sql.Tx, table TableName, records []Record, opt UpdateOption) (affected int64, err error) {
+	return BatchUpdateTransactionContext(context.Background(), tx, table, records, opt)
+}
+
+// BatchUpdateTransactionContext updates many rows by `UPDATE ... FROM (VALUES ...)`.
+// Since empty values are omitted, records are grouped by the columns to set, and each group is updated by its own statements.
+func BatchUpdateTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt UpdateOption) (affected int64, err error) {
+	// group records of the same columns, keeping the order of groups stable
+	var shapes []string
+	groups := make(map[string][]Record)
+	numColumns := make(map[string]int)
+	versioned := make(map[string]bool)
+	for _, rec := range records {
+		keys, sets, _, e := splitUpdateColumns(table, rec, opt)
+		if e != nil {
+			err = e
+			glog.Error(err)
+			return
+		}
+		shape := strings.Join(keys, ",") + ";" + strings.Join(sets, ",")
+		if _, ok := groups[shape]; !ok {
+			shapes = append(shapes, shape)
+			numColumns[shape] = len(keys) + len(sets)
+			versioned[shape] = conventionsOf(table).versioned(keys)
+		}
+		groups[shape] = append(groups[shape], rec)
+	}
+
+	var conflicts int
+	for _, shape := range shapes {
+		recs := groups[shape]
+		batchSize := PlaceholderLimit / numColumns[shape]
+
+		for m := 0; m < len(recs); m += batchSize {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+
+			n := m + batchSize
+			if n > len(recs) {
+				n = len(recs)
+			}
+
+			query, args, e := MakeBatchUpdateQuery(table, recs[m:n], opt)
+			if e != nil {
+				err = e
+				glog.Error(err)
+				return
+			}
+			res, e := execObserved(ctx, tx, query, args)
+			if e != nil {
+				err = e
+				glog.Error(err)
+				return
+			}
+			count, e := res.RowsAffected()
+			if e != nil {
+				err = e
+				glog.Error(err)
+				return
+			}
+			affected += count
+			if versioned[shape] {
+				conflicts += (n - m) - int(count)
+			}
+		}
+	}
+
+	if conflicts > 0 {
+		err = &ConflictError{Table: table, Conflicts: conflicts}
+		return
+	}
+
+	return
+}
+
+// MakeBatchUpdateQuery makes a query updating records of the same columns, e.g.
+//    UPDATE users AS t SET age = vs.age, name = vs.name
+//    FROM (VALUES ((NULL::users).id, (NULL::users).age, (NULL::users).name), ($1, $2, $3), ($4, $5, $6)) AS vs(id, age, name)
+//    WHERE t.id = vs.id
+func MakeBatchUpdateQuery(table TableName, records []Record, opt UpdateOption) (query string, args []interface{}, err error) {
+	if len(records) == 0 {
+		err = fmt.Errorf("empty updating records")
+		return
+	}
+
+	keys, sets, _, err := splitUpdateColumns(table, records[0], opt)
+	if err != nil {
+		return
+	}
+	columns := append(append([]string{}, keys...), sets...)
+	shape := strings.Join(columns, ",")
+
+	var values []map[string]interface{}
+	for _, rec := range records {
+		currKeys, currSets, vs, e := splitUpdateColumns(table, rec, opt)
+		if e != nil {
+			err = e
+			return
+		}
+		if currShape := strings.Join(append(currKeys, currSets...), ","); currShape != shape {
+			err = fmt.Errorf("records have different columns: %s and %s", shape, currShape)
+			return
+		}
+		values = append(values, vs)
+	}
+
+	// values are selected from `VALUES`, thus should be typed
+	rows := []string{typedValuesRow(table, columns)}
+	for _, vs := range values {
+		var phds []string
+		for _, f := range columns {
+			args = append(args, vs[f])
+			phds = append(phds, fmt.Sprintf("$%d", len(args)))
+		}
+		rows = append(rows, "("+strings.Join(phds, ",")+")")
+	}
+
+	var setClauses, whereClauses []string
+	for _, col := range sets {
+		setClauses = append(setClauses, fmt.Sprintf("%s = vs.%s", col, col))
+	}
+	for _, col := range keys {
+		whereClauses = append(whereClauses, fmt.Sprintf("t.%s = vs.%s", col, col))
+	}
+	if c := conventionsOf(table); c != nil {
+		if c.Version != "" {
+			setClauses = append(setClauses, fmt.Sprintf("%s = t.%s + 1", c.Version, c.Version))
+		}
+		if c.DeletedAt != "" {
+			whereClauses = append(whereClauses, fmt.Sprintf("t.%s IS NULL", c.DeletedAt))
+		}
+	}
+
+	query = fmt.Sprintf(`
+	UPDATE %s AS t SET %s
+	FROM (
+		VALUES %s
+	) AS vs(%s)
+	WHERE %s`,
+		table,
+		strings.Join(setClauses, ","),
+		strings.Join(rows, ","),
+		strings.Join(columns, ","),
+		strings.Join(whereClauses, " AND "),
+	)
+	return
+}
+
+// BatchDelete ...
+func BatchDelete(q Execer, table TableName, key ColumnName, keys interface{}) (affected int64, err error) {
+	return BatchDeleteContext(context.Background(), q, table, key, keys)
+}
+
+// BatchDeleteContext deletes rows whose `key` column is in `keys`, which must be a slice, by a single statement like
+//    DELETE FROM users WHERE id = ANY($1)
+// or soft deletes them under `Conventions.DeletedAt`.
+func BatchDeleteContext(ctx context.Context, q Execer, table TableName, key ColumnName, keys interface{}) (affected int64, err error) {
+	query, args := makeDeleteQuery(table, fmt.Sprintf(`%s = ANY($1)`, key), []interface{}{pq.Array(keys)})
+	res, err := execObserved(ctx, q, query, args)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return res.RowsAffected()
+}
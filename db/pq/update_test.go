@@ -0,0 +1,96 @@
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type updateRecord struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+	Age  int    `db:"age"`
+}
+
+func TestMakeUpdateQuery(t *testing.T) {
+	opt := UpdateOption{KeyColumns: []ColumnName{"id"}}
+
+	query, args, err := MakeUpdateQuery("users", updateRecord{ID: 1, Name: "Tom"}, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE users SET name = $1 WHERE id = $2", query)
+	assert.Equal(t, []interface{}{"Tom", 1}, args)
+
+	opt.KeepEmptyValueColums = []ColumnName{"age"}
+	query, args, err = MakeUpdateQuery("users", updateRecord{ID: 1, Name: "Tom"}, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE users SET age = $1,name = $2 WHERE id = $3", query)
+	assert.Equal(t, []interface{}{0, "Tom", 1}, args)
+
+	_, _, err = MakeUpdateQuery("users", updateRecord{ID: 1}, UpdateOption{KeyColumns: []ColumnName{"id"}})
+	assert.NotNil(t, err)
+}
+
+func TestMakeBatchUpdateQuery(t *testing.T) {
+	opt := UpdateOption{KeyColumns: []ColumnName{"id"}}
+
+	_, args, err := MakeBatchUpdateQuery("users", []Record{
+		updateRecord{ID: 1, Name: "Tom", Age: 3},
+		updateRecord{ID: 2, Name: "Jerry", Age: 4},
+	}, opt)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{1, 3, "Tom", 2, 4, "Jerry"}, args)
+
+	_, _, err = MakeBatchUpdateQuery("users", []Record{
+		updateRecord{ID: 1, Name: "Tom", Age: 3},
+		updateRecord{ID: 2, Name: "Jerry"},
+	}, opt)
+	assert.NotNil(t, err)
+}
+
+func TestMakeBatchUpdateQueryTypes(t *testing.T) {
+	// values take the column types from the first row, rather than being narrowed to integer
+	type bigRecord struct {
+		ID    int64  `db:"id"`
+		Views uint64 `db:"views"`
+	}
+	query, args, err := MakeBatchUpdateQuery("events", []Record{bigRecord{ID: 1 << 40, Views: 1 << 40}}, UpdateOption{KeyColumns: []ColumnName{"id"}})
+	assert.Nil(t, err)
+	assert.Contains(t, query, "VALUES ((NULL::events).id,(NULL::events).views),($1,$2)")
+	assert.Equal(t, []interface{}{int64(1 << 40), uint64(1 << 40)}, args)
+
+	// times are bound as is, as `Update` does
+	type record struct {
+		ID       int       `db:"id"`
+		LoggedAt time.Time `db:"logged_at"`
+	}
+	loggedAt := time.Date(2020, 1, 2, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	query, args, err = MakeBatchUpdateQuery("users", []Record{record{ID: 1, LoggedAt: loggedAt}}, UpdateOption{KeyColumns: []ColumnName{"id"}})
+	assert.Nil(t, err)
+	assert.Contains(t, query, "VALUES ((NULL::users).id,(NULL::users).logged_at),($1,$2)")
+	assert.Equal(t, []interface{}{1, loggedAt}, args)
+
+	// strings are not left as text, which can not be compared with uuid
+	type device struct {
+		UUID string `db:"uuid"`
+		Name string `db:"name"`
+	}
+	query, _, err = MakeBatchUpdateQuery("devices", []Record{
+		device{UUID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "phone"},
+	}, UpdateOption{KeyColumns: []ColumnName{"uuid"}})
+	assert.Nil(t, err)
+	assert.Contains(t, query, "VALUES ((NULL::devices).uuid,(NULL::devices).name),($1,$2)")
+	assert.Contains(t, query, "WHERE t.uuid = vs.uuid")
+}
+
+func TestMakeUpdateQueryReadOnlyKey(t *testing.T) {
+	r := struct {
+		ID   int    `db:"id,readonly"`
+		Name string `db:"name"`
+	}{ID: 1, Name: "Tom"}
+
+	query, args, err := MakeUpdateQuery("users", r, UpdateOption{KeyColumns: []ColumnName{"id"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "UPDATE users SET name = $1 WHERE id = $2", query)
+	assert.Equal(t, []interface{}{"Tom", 1}, args)
+}
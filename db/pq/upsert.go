@@ -0,0 +1,435 @@
+package pq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Upsert describes an `ON CONFLICT` clause, e.g.
+//    Upsert{
+//        ConflictColumns: []ColumnName{"email"},
+//        UpdateColumns:   []ColumnName{"name"},
+//    }
+// will result in
+//    ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name
+type Upsert struct {
+	// Columns of the unique index or constraint arbitrating conflicts.
+	ConflictColumns []ColumnName
+
+	// Columns to overwrite on conflict.
+	// If empty, all inserting columns other than `ConflictColumns` are overwritten.
+	// Note that a column missing from a record is inserted as NULL, and thus also overwritten as NULL.
+	// Under conventions, `UpdatedAt` is always overwritten, and `Version` is increased instead.
+	UpdateColumns []ColumnName
+
+	// Leave the existing row untouched on conflict.
+	DoNothing bool
+}
+
+// UpsertResult ...
+type UpsertResult struct {
+	ID int
+
+	// Inserted is false if the record conflicted with an existing row, which is then updated or left untouched.
+	Inserted bool
+}
+
+func (opt InsertOption) onConflictClause(table TableName, columns []string) (clause string, err error) {
+	if opt.Upsert == nil {
+		clause = opt.OnConflict
+		return
+	}
+	if opt.OnConflict != "" {
+		err = fmt.Errorf("OnConflict and Upsert can not be both provided")
+		return
+	}
+	return opt.Upsert.clause(table, columns)
+}
+
+// clause overwrites conflicting rows of `table` as an update does under conventions, except that `CreatedAt` is kept.
+func (u Upsert) clause(table TableName, columns []string) (clause string, err error) {
+	var target string
+	if len(u.ConflictColumns) > 0 {
+		target = "(" + joinColumnNames(u.ConflictColumns) + ") "
+	}
+
+	if u.DoNothing {
+		clause = "ON CONFLICT " + target + "DO NOTHING"
+		return
+	}
+	if target == "" {
+		err = fmt.Errorf("missing conflict columns")
+		return
+	}
+
+	conv := conventionsOf(table)
+
+	updateColumns := u.UpdateColumns
+	if len(updateColumns) == 0 {
+		isConflictColumn := make(map[string]bool)
+		for _, c := range u.ConflictColumns {
+			isConflictColumn[string(c)] = true
+		}
+		if conv != nil {
+			isConflictColumn[string(conv.CreatedAt)] = true
+			isConflictColumn[string(conv.Version)] = true
+		}
+		for _, c := range columns {
+			if !isConflictColumn[c] {
+				updateColumns = append(updateColumns, ColumnName(c))
+			}
+		}
+	} else if conv != nil {
+		// the version is increased rather than set, as `splitUpdateColumns` does
+		updateColumns = nil
+		var hasUpdatedAt bool
+		for _, c := range u.UpdateColumns {
+			if conv.Version != "" && c == conv.Version {
+				continue
+			}
+			hasUpdatedAt = hasUpdatedAt || c == conv.UpdatedAt
+			updateColumns = append(updateColumns, c)
+		}
+		if conv.UpdatedAt != "" && !hasUpdatedAt {
+			updateColumns = append(updateColumns, conv.UpdatedAt)
+		}
+	}
+	if len(updateColumns) == 0 {
+		err = fmt.Errorf("no column to update on conflict")
+		return
+	}
+
+	var sets []string
+	for _, c := range updateColumns {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+	}
+	if conv != nil && conv.Version != "" {
+		// unqualified columns are ambiguous with `EXCLUDED`
+		sets = append(sets, fmt.Sprintf("%s = %s.%s + 1", conv.Version, table, conv.Version))
+	}
+	clause = "ON CONFLICT " + target + "DO UPDATE SET " + strings.Join(sets, ",")
+
+	return
+}
+
+// BatchUpsert ...
+func BatchUpsert(dbase *sql.DB, table TableName, records []Record, upsert Upsert) (results []UpsertResult, err error) {
+	return BatchUpsertWithOption(dbase, table, records, InsertOption{Upsert: &upsert})
+}
+
+// BatchUpsertContext ...
+func BatchUpsertContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, upsert Upsert) (results []UpsertResult, err error) {
+	return BatchUpsertWithOptionContext(ctx, dbase, table, records, InsertOption{Upsert: &upsert})
+}
+
+// BatchUpsertWithOption ...
+func BatchUpsertWithOption(dbase *sql.DB, table TableName, records []Record, opt InsertOption) (results []UpsertResult, err error) {
+	return BatchUpsertWithOptionContext(context.Background(), dbase, table, records, opt)
+}
+
+// BatchUpsertWithOptionContext ...
+func BatchUpsertWithOptionContext(ctx context.Context, dbase *sql.DB, table TableName, records []Record, opt InsertOption) (results []UpsertResult, err error) {
+	err = WithTransactionContext(ctx, dbase, nil, func(tx *sql.Tx) (abort bool, err error) {
+		results, err = BatchUpsertTransactionContext(ctx, tx, table, records, opt)
+		if opt.Abort != nil {
+			abort = *opt.Abort
+		}
+		return
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	return
+}
+
+// BatchUpsertTransaction inserts records and resolves conflicts as told by `opt.Upsert`.
+// Unlike `BatchInsertTransaction`, one result is returned for each record in the same order,
+// including records conflicting with existing rows under `DoNothing`.
+// `opt.ForeignKeys` and `opt.NoID` are not supported.
+func BatchUpsertTransaction(tx *sql.Tx, table TableName, records []Record, opt InsertOption) (results []UpsertResult, err error) {
+	return BatchUpsertTransactionContext(context.Background(), tx, table, records, opt)
+}
+
+// BatchUpsertTransactionContext ...
+func BatchUpsertTransactionContext(ctx context.Context, tx *sql.Tx, table TableName, records []Record, opt InsertOption) (results []UpsertResult, err error) {
+	if opt.Upsert == nil {
+		err = fmt.Errorf("missing Upsert")
+		glog.Error(err)
+		return
+	}
+	if opt.NoID || len(opt.ForeignKeys) > 0 {
+		err = fmt.Errorf("NoID and ForeignKeys are not supported in upserting")
+		glog.Error(err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	columns, err := insertColumns(table, records, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	stmts := newStmtCache(tx)
+	defer stmts.close()
+
+	results = make([]UpsertResult, len(records))
+	var offset int
+	err = forEachBatch(ctx, records, columns, opt, func(recs []Record) error {
+		if e := upsertBatch(ctx, stmts, table, recs, columns, opt, results[offset:offset+len(recs)]); e != nil {
+			return e
+		}
+		offset += len(recs)
+		return nil
+	})
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	// in case of aborting
+	results = results[:offset]
+
+	return
+}
+
+func upsertBatch(ctx context.Context, stmts *stmtCache, table TableName, records []Record, columns []string, opt InsertOption, results []UpsertResult) (err error) {
+	query, args, empty, err := MakeBatchUpsertQuery(table, records, columns, opt)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	if empty {
+		return
+	}
+
+	start := time.Now()
+	var affected int64
+	defer func() {
+		observe(ctx, QueryKindQuery, query, len(args), start, affected, err)
+	}()
+
+	stt, err := stmts.prepare(ctx, query)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	rows, err := stt.QueryContext(ctx, args...)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+	defer rows.Close()
+
+	found := make([]bool, len(results))
+	for rows.Next() {
+		var ord int
+		var res UpsertResult
+		if err = rows.Scan(&ord, &res.ID, &res.Inserted); err != nil {
+			glog.Error(err)
+			return
+		}
+		if ord < 0 || ord >= len(results) {
+			err = fmt.Errorf("unexpected record ordinal %d", ord)
+			glog.Error(err)
+			return
+		}
+		results[ord] = res
+		found[ord] = true
+		affected++
+	}
+	if err = rows.Err(); err != nil {
+		glog.Error(err)
+		return
+	}
+
+	for i, ok := range found {
+		if !ok {
+			err = fmt.Errorf("record %d is neither inserted nor found, it may conflict on columns other than %v", i, opt.Upsert.ConflictColumns)
+			glog.Error(err)
+			return
+		}
+	}
+
+	return
+}
+
+// upsertOrdinalColumn numbers records in a batch so that returned rows can be lined up with them.
+const upsertOrdinalColumn = "upsert_ord"
+
+// MakeBatchUpsertQuery makes a query returning the ordinal of each record in the batch, together with its id and whether it is inserted, e.g.
+//    WITH vs(upsert_ord, email, name) AS (
+//        VALUES (NULL::integer, (NULL::users).email, (NULL::users).name), (0, $1, $2), (1, $3, $4)
+//    ), ins AS (
+//        INSERT INTO users (email, name)
+//        SELECT email, name FROM vs WHERE upsert_ord IS NOT NULL ORDER BY upsert_ord
+//        ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name
+//        RETURNING id, email, (xmax = 0) AS inserted
+//    )
+//    SELECT vs.upsert_ord, ins.id, ins.inserted FROM vs JOIN ins ON vs.email = ins.email
+// The first row of NULLs only types the values as columns of the table.
+// Under `DoNothing`, rows conflicting with the records are additionally selected from the table.
+// Otherwise records of the same conflicting values are rejected, as a row can not be updated twice by a statement.
+func MakeBatchUpsertQuery(table TableName, records []Record, columns []string, opt InsertOption) (query string, args []interface{}, empty bool, err error) {
+	if opt.Upsert == nil {
+		err = fmt.Errorf("missing Upsert")
+		glog.Error(err)
+		return
+	}
+	if len(columns) == 0 {
+		err = fmt.Errorf("empty inserting fields")
+		glog.Error(err)
+		return
+	}
+	conflictColumns := opt.Upsert.ConflictColumns
+	if len(conflictColumns) == 0 {
+		err = fmt.Errorf("missing conflict columns")
+		glog.Error(err)
+		return
+	}
+	isColumn := make(map[string]bool)
+	for _, c := range columns {
+		isColumn[c] = true
+	}
+	for _, c := range conflictColumns {
+		if !isColumn[string(c)] {
+			err = fmt.Errorf("conflict column %s is not inserted", c)
+			glog.Error(err)
+			return
+		}
+	}
+
+	var values []map[string]interface{}
+	for _, rec := range records {
+		values = append(values, mapColumn(table, rec, opt))
+	}
+	if len(values) == 0 {
+		empty = true
+		return
+	}
+
+	if !opt.Upsert.DoNothing {
+		// otherwise PostgreSQL fails as the command can not affect a row a second time
+		if err = checkDuplicateConflicts(values, conflictColumns); err != nil {
+			glog.Error(err)
+			return
+		}
+	}
+
+	// values are selected from `VALUES`, thus should be typed by the first row
+	nulls := []string{"NULL::integer"}
+	for _, c := range columns {
+		nulls = append(nulls, typedNull(table, c))
+	}
+	rows := []string{"(" + strings.Join(nulls, ",") + ")"}
+	for ord, vs := range values {
+		phds := []string{fmt.Sprintf("%d", ord)}
+		for _, f := range columns {
+			args = append(args, vs[f])
+			phds = append(phds, fmt.Sprintf("$%d", len(args)))
+		}
+		rows = append(rows, "("+strings.Join(phds, ",")+")")
+	}
+
+	onConflict, err := opt.Upsert.clause(table, columns)
+	if err != nil {
+		glog.Error(err)
+		return
+	}
+
+	var joinIns, joinTable []string
+	for _, c := range conflictColumns {
+		joinIns = append(joinIns, fmt.Sprintf("vs.%s = ins.%s", c, c))
+		joinTable = append(joinTable, fmt.Sprintf("vs.%s = t.%s", c, c))
+	}
+	fieldStr := strings.Join(columns, ",")
+
+	query = fmt.Sprintf(`
+	WITH vs(%s, %s) AS (
+		VALUES %s
+	), ins AS (
+		INSERT INTO %s
+			(%s)
+		SELECT
+			%s
+		FROM vs
+		WHERE %s IS NOT NULL
+		ORDER BY %s
+		%s
+		RETURNING id, %s, (xmax = 0) AS inserted
+	)
+	SELECT vs.%s, ins.id, ins.inserted FROM vs JOIN ins ON %s`,
+		upsertOrdinalColumn,
+		fieldStr,
+		strings.Join(rows, ","),
+		table,
+		fieldStr,
+		fieldStr,
+		upsertOrdinalColumn,
+		upsertOrdinalColumn,
+		onConflict,
+		joinColumnNames(conflictColumns),
+		upsertOrdinalColumn,
+		strings.Join(joinIns, " AND "),
+	)
+
+	if opt.Upsert.DoNothing {
+		// rows inserted by `ins` are invisible to the rest of the statement,
+		// thus the table only yields the pre-existing rows which are left untouched.
+		query += fmt.Sprintf(`
+	UNION ALL
+	SELECT vs.%s, t.id, false FROM vs JOIN %s AS t ON %s`,
+			upsertOrdinalColumn,
+			table,
+			strings.Join(joinTable, " AND "),
+		)
+	}
+
+	return
+}
+
+// checkDuplicateConflicts fails if records have the same values of `conflictColumns`, which never equal if any of them is NULL.
+func checkDuplicateConflicts(values []map[string]interface{}, conflictColumns []ColumnName) error {
+	seen := make(map[string]int)
+	for ord, vs := range values {
+		var key []string
+		for _, c := range conflictColumns {
+			v := reflect.ValueOf(vs[string(c)])
+			for v.Kind() == reflect.Ptr && !v.IsNil() {
+				v = v.Elem()
+			}
+			if !v.IsValid() || v.Kind() == reflect.Ptr {
+				key = nil
+				break
+			}
+			key = append(key, fmt.Sprintf("%#v", v.Interface()))
+		}
+		if key == nil {
+			continue
+		}
+		k := strings.Join(key, ",")
+		if prev, ok := seen[k]; ok {
+			return fmt.Errorf("records %d and %d conflict with each other on %s (%s)", prev, ord, joinColumnNames(conflictColumns), k)
+		}
+		seen[k] = ord
+	}
+	return nil
+}
+
+func joinColumnNames(cols []ColumnName) string {
+	var names []string
+	for _, c := range cols {
+		names = append(names, string(c))
+	}
+	return strings.Join(names, ",")
+}
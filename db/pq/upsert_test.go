@@ -0,0 +1,63 @@
+package pq
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsertClause(t *testing.T) {
+	columns := []string{"email", "name", "age"}
+
+	clause, err := Upsert{ConflictColumns: []ColumnName{"email"}}.clause("users", columns)
+	assert.Nil(t, err)
+	assert.Equal(t, "ON CONFLICT (email) DO UPDATE SET name = EXCLUDED.name,age = EXCLUDED.age", clause)
+
+	clause, err = Upsert{ConflictColumns: []ColumnName{"email"}, UpdateColumns: []ColumnName{"age"}}.clause("users", columns)
+	assert.Nil(t, err)
+	assert.Equal(t, "ON CONFLICT (email) DO UPDATE SET age = EXCLUDED.age", clause)
+
+	clause, err = Upsert{DoNothing: true}.clause("users", columns)
+	assert.Nil(t, err)
+	assert.Equal(t, "ON CONFLICT DO NOTHING", clause)
+
+	_, err = Upsert{}.clause("users", columns)
+	assert.NotNil(t, err)
+
+	_, err = InsertOption{OnConflict: "ON CONFLICT DO NOTHING", Upsert: &Upsert{DoNothing: true}}.onConflictClause("users", columns)
+	assert.NotNil(t, err)
+}
+
+func TestMakeBatchUpsertQuery(t *testing.T) {
+	type device struct {
+		UUID string `db:"uuid"`
+		Name string `db:"name"`
+	}
+	opt := InsertOption{Upsert: &Upsert{ConflictColumns: []ColumnName{"uuid"}}}
+	columns := []string{"uuid", "name"}
+
+	// values take the column types, e.g. uuid, from the first row
+	query, args, empty, err := MakeBatchUpsertQuery("devices", []Record{
+		device{UUID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "phone"},
+		device{UUID: "6ba7b811-9dad-11d1-80b4-00c04fd430c8", Name: "pad"},
+	}, columns, opt)
+	assert.Nil(t, err)
+	assert.False(t, empty)
+	assert.Contains(t, query, "VALUES (NULL::integer,(NULL::devices).uuid,(NULL::devices).name),(0,$1,$2),(1,$3,$4)")
+	assert.Regexp(t, `FROM vs\s+WHERE upsert_ord IS NOT NULL\s+ORDER BY upsert_ord`, query)
+	assert.Len(t, args, 4)
+
+	// a row can not be updated twice
+	records := []Record{
+		device{UUID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "phone"},
+		device{Name: "pad"},
+		device{UUID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Name: "pad"},
+	}
+	_, _, _, err = MakeBatchUpsertQuery("devices", records, columns, opt)
+	assert.EqualError(t, err, `records 0 and 2 conflict with each other on uuid ("6ba7b810-9dad-11d1-80b4-00c04fd430c8")`)
+
+	// but can be left untouched twice
+	opt.Upsert.DoNothing = true
+	_, _, _, err = MakeBatchUpsertQuery("devices", records, columns, opt)
+	assert.Nil(t, err)
+}